@@ -1,10 +1,61 @@
 package ara
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
+
+type clientConfig struct {
+	client    *http.Client
+	transport []TransportOption
+}
+
+// A ClientOption configures the client returned by NewClient.
+type ClientOption func(c *clientConfig)
+
+// WithTimeout sets the overall Timeout of the client's requests.
+// The default is no timeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.client.Timeout = timeout
+	}
+}
+
+// WithCheckRedirect sets the redirect policy of the client.
+// See http.Client.CheckRedirect.
+func WithCheckRedirect(checkRedirect func(req *http.Request, via []*http.Request) error) ClientOption {
+	return func(c *clientConfig) {
+		c.client.CheckRedirect = checkRedirect
+	}
+}
+
+// WithCookieJar sets the cookie jar of the client.
+func WithCookieJar(jar http.CookieJar) ClientOption {
+	return func(c *clientConfig) {
+		c.client.Jar = jar
+	}
+}
+
+// WithTransportOptions configures the client's transport with the
+// given options, as NewTransport does.
+func WithTransportOptions(opts ...TransportOption) ClientOption {
+	return func(c *clientConfig) {
+		c.transport = append(c.transport, opts...)
+	}
+}
 
 // NewClient returns a *http.Client that uses the given resolver while dialing.
-func NewClient(r Resolver) *http.Client {
-	return &http.Client{
-		Transport: NewTransport(r),
+//
+// Its settings can be changed with options, like
+//
+//	NewClient(r, WithTimeout(time.Minute), WithTransportOptions(WithHTTP2(false)))
+func NewClient(r Resolver, opts ...ClientOption) *http.Client {
+	c := &clientConfig{
+		client: &http.Client{},
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	c.client.Transport = NewTransport(r, c.transport...)
+	return c.client
 }
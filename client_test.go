@@ -7,7 +7,9 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -45,3 +47,31 @@ func TestNewClient(t *testing.T) {
 		t.Fatal("failed")
 	}
 }
+
+func TestClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.RedirectHandler("/elsewhere", http.StatusFound))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ara.NewClient(
+		ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}),
+		ara.WithTimeout(time.Minute),
+		ara.WithCheckRedirect(func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}),
+		ara.WithTransportOptions(ara.WithProxy(nil)),
+	)
+	if client.Timeout != time.Minute {
+		t.Error("timeout is not set")
+	}
+	response, err := client.Get("http://example.com:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Errorf("redirect is followed, got status %d", response.StatusCode)
+	}
+}
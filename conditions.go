@@ -0,0 +1,203 @@
+package ara
+
+import (
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConditionRule describes the network conditions simulated on the
+// connections to the hosts it matches.
+type ConditionRule struct {
+	// Pattern is matched against the host names as in HostRule, like
+	// ".example.com" for example.com and all of its subdomains. An
+	// empty pattern matches every host.
+	Pattern string
+
+	// Latency is added to every read and write.
+	Latency time.Duration
+
+	// Jitter is the maximum random duration added to Latency.
+	Jitter time.Duration
+
+	// Bandwidth caps the bytes per second read and written, in each
+	// direction.
+	//
+	// Zero means no cap.
+	Bandwidth int
+
+	// ResetRate is the probability, between 0 and 1, that each read,
+	// and each chunk of a write, resets the connection.
+	ResetRate float64
+
+	// MaxWriteSize splits the writes into chunks of at most this many
+	// bytes, written one by one, so that the peer receives the data
+	// in parts. A write that is interrupted by a reset is left
+	// partially done.
+	//
+	// Zero means the writes are not split.
+	MaxWriteSize int
+}
+
+// NetworkConditions simulates slow and unreliable links on the
+// connections of a Dialer, to test how clients behave on them without
+// shaping the actual traffic.
+//
+// The conditions are applied to the connections to the target hosts,
+// also when they are reached through a Proxy. The random ones are
+// seeded, so that the same sequence of operations sees the same
+// conditions.
+//
+// NetworkConditions is safe for concurrent use and can be shared
+// between multiple Dialers.
+type NetworkConditions struct {
+	// Rules lists the simulated conditions. For each connection, the
+	// first rule that matches the host applies.
+	Rules []ConditionRule
+
+	// Seed seeds the random conditions.
+	Seed int64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// wrap returns c with the conditions of the rule that matches the host
+// of address, or c itself if no rule matches.
+func (n *NetworkConditions) wrap(address string, c net.Conn) net.Conn {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	for i := range n.Rules {
+		if matchPattern(n.Rules[i].Pattern, host) {
+			return &conditionedConn{Conn: c, conditions: n, rule: &n.Rules[i]}
+		}
+	}
+	return c
+}
+
+// delay returns the latency of rule with a random jitter.
+func (n *NetworkConditions) delay(rule *ConditionRule) time.Duration {
+	if rule.Jitter <= 0 {
+		return rule.Latency
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return rule.Latency + time.Duration(n.random().Int63n(int64(rule.Jitter)))
+}
+
+// reset reports whether the connection is to be reset, for rule.
+func (n *NetworkConditions) reset(rule *ConditionRule) bool {
+	if rule.ResetRate <= 0 {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.random().Float64() < rule.ResetRate
+}
+
+func (n *NetworkConditions) random() *rand.Rand {
+	if n.rand == nil {
+		n.rand = rand.New(rand.NewSource(n.Seed))
+	}
+	return n.rand
+}
+
+// conditionedConn is a connection with simulated network conditions.
+type conditionedConn struct {
+	net.Conn
+	conditions *NetworkConditions
+	rule       *ConditionRule
+
+	mu         sync.Mutex
+	resetErr   error
+	readMu     sync.Mutex
+	writeMu    sync.Mutex
+	readUntil  time.Time
+	writeUntil time.Time
+}
+
+func (c *conditionedConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	time.Sleep(c.conditions.delay(c.rule))
+	if err := c.checkReset("read"); err != nil {
+		return 0, err
+	}
+	if c.rule.Bandwidth > 0 && len(b) > c.rule.Bandwidth {
+		// Do not read more than a second worth of data at once.
+		b = b[:c.rule.Bandwidth]
+	}
+	n, err := c.Conn.Read(b)
+	c.readUntil = c.pace(c.readUntil, n)
+	return n, err
+}
+
+func (c *conditionedConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	time.Sleep(c.conditions.delay(c.rule))
+	chunk := len(b)
+	if c.rule.MaxWriteSize > 0 && chunk > c.rule.MaxWriteSize {
+		chunk = c.rule.MaxWriteSize
+	}
+	if c.rule.Bandwidth > 0 && chunk > c.rule.Bandwidth {
+		chunk = c.rule.Bandwidth
+	}
+	var written int
+	for {
+		if err := c.checkReset("write"); err != nil {
+			return written, err
+		}
+		end := written + chunk
+		if end > len(b) {
+			end = len(b)
+		}
+		n, err := c.Conn.Write(b[written:end])
+		written += n
+		c.writeUntil = c.pace(c.writeUntil, n)
+		if err != nil || written == len(b) {
+			return written, err
+		}
+	}
+}
+
+// pace waits for n bytes to go through the capped bandwidth, in a
+// direction whose previous bytes go through until the given time, and
+// returns the time the n bytes go through.
+func (c *conditionedConn) pace(until time.Time, n int) time.Time {
+	if c.rule.Bandwidth <= 0 || n <= 0 {
+		return until
+	}
+	now := time.Now()
+	if until.Before(now) {
+		until = now
+	}
+	until = until.Add(time.Duration(n) * time.Second / time.Duration(c.rule.Bandwidth))
+	time.Sleep(time.Until(until))
+	return until
+}
+
+// checkReset returns the error of the operation op if the connection
+// is reset, resetting it at random first.
+func (c *conditionedConn) checkReset(op string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resetErr == nil && c.conditions.reset(c.rule) {
+		// Make closing the connection send a reset to the peer,
+		// when it is a TCP connection.
+		if tcp, ok := c.Conn.(*net.TCPConn); ok {
+			_ = tcp.SetLinger(0)
+		}
+		_ = c.Conn.Close()
+		c.resetErr = syscall.ECONNRESET
+	}
+	if c.resetErr == nil {
+		return nil
+	}
+	return &net.OpError{Op: op, Net: c.LocalAddr().Network(), Source: c.LocalAddr(), Addr: c.RemoteAddr(), Err: os.NewSyscallError(op, c.resetErr)}
+}
@@ -0,0 +1,104 @@
+package ara_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestNetworkConditions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	serverErrs := make(chan error, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, err := io.Copy(conn, conn)
+				serverErrs <- err
+				_ = conn.Close()
+			}()
+		}
+	}()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := &ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{
+			"slow.example.com":   {"127.0.0.1"},
+			"narrow.example.com": {"127.0.0.1"},
+			"flaky.example.com":  {"127.0.0.1"},
+		}),
+		Conditions: &ara.NetworkConditions{
+			Rules: []ara.ConditionRule{
+				{Pattern: "slow.example.com", Latency: 20 * time.Millisecond},
+				{Pattern: "narrow.example.com", Bandwidth: 50000},
+				{Pattern: "flaky.example.com", ResetRate: 0.1, MaxWriteSize: 10},
+			},
+			Seed: 1,
+		},
+	}
+	echo := func(host string, size int) time.Duration {
+		conn, err := dialer.DialContext(context.Background(), "tcp", host+":"+port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		data := bytes.Repeat([]byte{'a'}, size)
+		start := time.Now()
+		_, err = conn.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadFull(conn, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+	if elapsed := echo("slow.example.com", 10); elapsed < 40*time.Millisecond {
+		t.Errorf("round trip with a 20ms latency took %s", elapsed)
+	}
+	if elapsed := echo("narrow.example.com", 10000); elapsed < 200*time.Millisecond {
+		t.Errorf("echoing 10kB at 50kB/s took %s", elapsed)
+	}
+	<-serverErrs
+	<-serverErrs
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "flaky.example.com:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data := make([]byte, 10000)
+	n, err := conn.Write(data)
+	if n%10 != 0 || n == len(data) || !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("expected a partial write and a reset, wrote %d bytes with %v", n, err)
+	}
+	_, err = conn.Read(data)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("expected a reset connection, got %v", err)
+	}
+	select {
+	case err := <-serverErrs:
+		if !errors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("expected the server to see a reset, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the server did not see the reset")
+	}
+}
@@ -0,0 +1,113 @@
+package ara
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// HTTPProxy is a Proxy that tunnels connections through an HTTP or
+// HTTPS proxy server with the CONNECT method.
+type HTTPProxy struct {
+	// Addr is the address of the proxy server in host:port form.
+	Addr string
+
+	// TLSConfig, if not nil, makes the connection to the proxy
+	// server itself use TLS, as with an HTTPS proxy. If its
+	// ServerName is empty, the host of Addr is used.
+	TLSConfig *tls.Config
+
+	// Username and Password are sent to the proxy server with the
+	// basic authentication scheme, if Username is not empty.
+	Username string
+	Password string
+
+	// Header optionally specifies additional headers to send with
+	// the CONNECT requests.
+	Header http.Header
+}
+
+// Server implements Proxy.
+func (p *HTTPProxy) Server() string {
+	return p.Addr
+}
+
+// Connect implements Proxy.
+func (p *HTTPProxy) Connect(ctx context.Context, conn net.Conn, network, target string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("http proxy: network not supported: " + network)
+	}
+	if p.TLSConfig != nil {
+		config := p.TLSConfig.Clone()
+		if config.ServerName == "" {
+			host, _, err := net.SplitHostPort(p.Addr)
+			if err != nil {
+				return nil, err
+			}
+			config.ServerName = host
+		}
+		conn = tls.Client(conn, config)
+	}
+	var br *bufio.Reader
+	err := handshake(ctx, conn, func() error {
+		var err error
+		br, err = p.connect(conn, target)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if br.Buffered() > 0 {
+		// The proxy server did not wait for us to start talking.
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+func (p *HTTPProxy) connect(conn net.Conn, target string) (*bufio.Reader, error) {
+	header := make(http.Header)
+	for key, values := range p.Header {
+		header[key] = values
+	}
+	if p.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.Username + ":" + p.Password))
+		header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: header,
+	}
+	err := request.Write(conn)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	response, err := http.ReadResponse(br, request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New("http proxy: " + response.Status)
+	}
+	return br, nil
+}
+
+// bufferedConn is a net.Conn that reads the already buffered data
+// first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,110 @@
+package ara_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestHTTPProxy(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("Alo?"))
+			_ = conn.Close()
+		}
+	}()
+	type connectRequest struct {
+		host, auth, custom string
+	}
+	requests := make(chan connectRequest, 1)
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		requests <- connectRequest{host: r.Host, auth: r.Header.Get("Proxy-Authorization"), custom: r.Header.Get("X-Custom")}
+		target, err := net.Dial("tcp", backend.Addr().String())
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(conn, target)
+	})}
+	go func() {
+		_ = server.Serve(proxy)
+	}()
+	defer server.Close()
+	_, proxyPort, err := net.SplitHostPort(proxy.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{
+			"proxy.example.com": {"127.0.0.1"},
+			"example.com":       {"127.0.0.2"},
+		}),
+		Proxy: &ara.HTTPProxy{
+			Addr:     "proxy.example.com:" + proxyPort,
+			Username: "user",
+			Password: "pass",
+			Header:   http.Header{"X-Custom": {"yes"}},
+		},
+	}
+	for _, remote := range []bool{false, true} {
+		dialer.RemoteResolve = remote
+		conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+		if string(body) != "Alo?" {
+			t.Errorf("wrong message %q", body)
+		}
+		expected := "127.0.0.2:80"
+		if remote {
+			expected = "example.com:80"
+		}
+		request := <-requests
+		if request.host != expected {
+			t.Errorf("expected the proxy to be asked for %s, got %s", expected, request.host)
+		}
+		if request.auth != "Basic dXNlcjpwYXNz" {
+			t.Errorf("wrong proxy authorization %q", request.auth)
+		}
+		if request.custom != "yes" {
+			t.Error("extra header is not sent")
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package ara
+
+import "context"
+
+type overrideKey struct{}
+
+// override is a resolver override carried in a context. Exactly one of
+// hosts and resolver is set.
+type override struct {
+	parent   *override
+	hosts    map[string][]string
+	resolver Resolver
+}
+
+// WithResolver returns a copy of ctx that makes the Dialers resolve
+// hosts with r, instead of their own Resolver, while dialing with it.
+//
+// It replaces any override previously set on ctx.
+//
+// An http.Transport pools its connections by scheme and host, so a
+// connection dialed with one override can be reused for the requests
+// with another one, or with none, sending them to the wrong address.
+// Use a PoolTransport to keep the connections of the overrides apart.
+func WithResolver(ctx context.Context, r Resolver) context.Context {
+	return context.WithValue(ctx, overrideKey{}, &override{resolver: r})
+}
+
+// WithHosts returns a copy of ctx that makes the Dialers give priority
+// to the given host/ip mappings, like map[host][]address, while dialing
+// with it.
+//
+// The hosts that are not part of the mapping are resolved as they
+// would be with ctx, so WithHosts calls can be stacked.
+//
+// An http.Transport pools its connections by scheme and host, so a
+// connection dialed with one override can be reused for the requests
+// with another one, or with none, sending them to the wrong address.
+// Use a PoolTransport to keep the connections of the overrides apart.
+func WithHosts(ctx context.Context, hosts map[string][]string) context.Context {
+	parent, _ := ctx.Value(overrideKey{}).(*override)
+	return context.WithValue(ctx, overrideKey{}, &override{parent: parent, hosts: normalizeHosts(hosts)})
+}
+
+// contextResolver returns the resolver to use for ctx, given that r
+// is the one to use when ctx has no overrides.
+func contextResolver(ctx context.Context, r Resolver) Resolver {
+	o, _ := ctx.Value(overrideKey{}).(*override)
+	return o.resolverFor(r)
+}
+
+func (o *override) resolverFor(r Resolver) Resolver {
+	if o == nil {
+		return r
+	}
+	if o.resolver != nil {
+		return o.resolver
+	}
+	return &resolver{
+		hosts:    o.hosts,
+		fallback: o.parent.resolverFor(r),
+	}
+}
+
+type poolKeyKey struct{}
+
+// WithPoolKey returns a copy of ctx that makes a PoolTransport keep the
+// connections of the requests made with it apart from the ones of the
+// requests with other keys, like the ones of another tenant.
+func WithPoolKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, poolKeyKey{}, key)
+}
+
+func poolKey(ctx context.Context) string {
+	key, _ := ctx.Value(poolKeyKey{}).(string)
+	return key
+}
@@ -0,0 +1,80 @@
+package ara_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestContextOverrides(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(first.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		_ = first.Close()
+		t.Skip(err)
+	}
+	for _, listener := range []net.Listener{first, second} {
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, _ := net.SplitHostPort(r.Context().Value(http.LocalAddrContextKey).(net.Addr).String())
+			_, _ = w.Write([]byte(host))
+		})}
+		go func(listener net.Listener) {
+			_ = server.Serve(listener)
+		}(listener)
+		defer server.Close()
+	}
+	client := ara.NewClient(
+		ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}),
+		ara.WithTransportOptions(ara.WithProxy(nil)),
+	)
+	get := func(ctx context.Context) string {
+		request, err := http.NewRequest(http.MethodGet, "http://example.com:"+port, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Do(request.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		return string(body)
+	}
+	if backend := get(context.Background()); backend != "127.0.0.1" {
+		t.Errorf("default mapping reached %s", backend)
+	}
+	// The transport reuses the connection of the previous request,
+	// which was dialed without the override.
+	ctx := ara.WithHosts(context.Background(), map[string][]string{"example.com": {"127.0.0.2"}})
+	if backend := get(ctx); backend != "127.0.0.1" {
+		t.Errorf("WithHosts with a pooled connection reached %s", backend)
+	}
+	client.CloseIdleConnections()
+	if backend := get(ctx); backend != "127.0.0.2" {
+		t.Errorf("WithHosts reached %s", backend)
+	}
+	client.CloseIdleConnections()
+	ctx = ara.WithHosts(ctx, map[string][]string{"other.example.com": {"127.0.0.1"}})
+	if backend := get(ctx); backend != "127.0.0.2" {
+		t.Errorf("stacked WithHosts reached %s", backend)
+	}
+	client.CloseIdleConnections()
+	ctx = ara.WithResolver(ctx, ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}))
+	if backend := get(ctx); backend != "127.0.0.1" {
+		t.Errorf("WithResolver reached %s", backend)
+	}
+}
@@ -93,6 +93,9 @@ type Dialer struct {
 	KeepAlive time.Duration
 
 	// Resolver optionally specifies an alternate resolver to use.
+	//
+	// It can be overridden per dial with the WithResolver and
+	// WithHosts contexts.
 	Resolver Resolver
 
 	// If Control is not nil, it is called after creating the network
@@ -103,6 +106,75 @@ type Dialer struct {
 	// will cause the Control function to be called with "tcp4" or "tcp6".
 	Control func(network, address string, c syscall.RawConn) error
 
+	// OutlierDetector optionally tracks dial failures per resolved
+	// address. Addresses that keep failing are tried last until
+	// their ejection time is over.
+	OutlierDetector *OutlierDetector
+
+	// Selector optionally decides the order in which the resolved
+	// addresses are dialed. If nil, they are dialed in the order
+	// the Resolver returns them.
+	Selector AddressSelector
+
+	// StickyCache optionally remembers the address that was last
+	// dialed successfully for each host and tries it first.
+	StickyCache *StickyCache
+
+	// Proxy optionally specifies a proxy to connect through. The
+	// connections to the proxy server are made as usual, while the
+	// targets are reached through the proxy.
+	Proxy Proxy
+
+	// RemoteResolve makes the Dialer pass the target host name to
+	// the Proxy as it is, leaving the resolution to the proxy
+	// server.
+	//
+	// By default, the target host is resolved with the Resolver
+	// and the Proxy is asked to connect to the resolved addresses.
+	RemoteResolve bool
+
+	// ServerNames optionally maps host names to the server names
+	// that DialTLSContext uses for SNI and certificate verification
+	// instead of the host names themselves.
+	ServerNames map[string]string
+
+	// HostTLS optionally maps host names to the TLS settings that
+	// DialTLSContext applies for them. A key may be a host name, a
+	// wildcard like "*.example.com" that matches every subdomain of
+	// example.com, or "*" that matches every host.
+	//
+	// They do not apply when an http.Transport sends an HTTPS request
+	// through a proxy of its own, as it makes the TLS handshake
+	// itself then. The transports built by this package fail such
+	// requests.
+	HostTLS map[string]*HostTLSConfig
+
+	// HostPolicy optionally restricts the host names and ports that
+	// can be dialed. It is checked before the host is resolved.
+	//
+	// Like IPPolicy, it cannot apply to the targets of an
+	// http.Transport that sends requests through a proxy of its own.
+	HostPolicy *HostPolicy
+
+	// IPPolicy optionally restricts the IP addresses that can be
+	// dialed. It is checked right before each address is dialed,
+	// and also applies to the targets requested from the Proxy.
+	//
+	// It cannot apply to the targets of an http.Transport that sends
+	// requests through a proxy of its own, as the Dialer only dials
+	// the proxy server then. The transports built by this package
+	// fail such requests.
+	IPPolicy *IPPolicy
+
+	// Limiter optionally caps the connections and dials made, and
+	// the rate of new dials.
+	Limiter *Limiter
+
+	// Conditions optionally simulates network conditions, like
+	// latency and limited bandwidth, on the connections to the hosts
+	// its rules match.
+	Conditions *NetworkConditions
+
 	// Underlying dialer
 	d *net.Dialer
 }
@@ -126,6 +198,48 @@ type Dialer struct {
 // See func net.Dial for a description of the network and address
 // parameters.
 func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.HostPolicy != nil && !isTrusted(ctx) {
+		err := d.HostPolicy.Check(address)
+		if err != nil {
+			saddr := simpleAddr{addr: address, network: network}
+			return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: saddr, Err: err}
+		}
+	}
+	if d.Limiter == nil {
+		return d.dial(ctx, network, address)
+	}
+	releaseDial, releaseConn, err := d.Limiter.acquireHost(ctx, address)
+	if err == nil {
+		err = d.Limiter.wait(ctx, address)
+		if err != nil {
+			releaseDial()
+			releaseConn()
+		}
+	}
+	if err != nil {
+		saddr := simpleAddr{addr: address, network: network}
+		return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: saddr, Err: err}
+	}
+	defer releaseDial()
+	c, err := d.dial(ctx, network, address)
+	return limitedConn(c, err, releaseConn)
+}
+
+func (d *Dialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	var c net.Conn
+	var err error
+	if d.Proxy != nil {
+		c, err = d.dialProxy(ctx, network, address)
+	} else {
+		c, err = d.dialDirect(ctx, network, address)
+	}
+	if err == nil && d.Conditions != nil {
+		c = d.Conditions.wrap(address, c)
+	}
+	return c, err
+}
+
+func (d *Dialer) dialDirect(ctx context.Context, network, address string) (net.Conn, error) {
 	host, port, err := net.SplitHostPort(address)
 	if err != nil {
 		return nil, err
@@ -135,14 +249,26 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	if ip != nil {
 		addresses = []string{address}
 	} else {
-		addresses, err = d.resolver().LookupHost(ctx, host)
+		records, err := d.resolver(ctx).LookupHost(ctx, host)
 		if err != nil {
 			return nil, err
 		}
-		for i, address := range addresses {
-			addresses[i] = net.JoinHostPort(address, port)
+		// Resolvers may hand out their own slices, so do not
+		// modify the records in place.
+		addresses = make([]string, len(records))
+		for i, record := range records {
+			addresses[i] = net.JoinHostPort(record, port)
 		}
 	}
+	if d.Selector != nil && ip == nil {
+		addresses = d.Selector.Select(ctx, host, addresses)
+	}
+	if d.StickyCache != nil && ip == nil {
+		addresses = d.StickyCache.order(address, addresses)
+	}
+	if d.OutlierDetector != nil {
+		addresses = d.OutlierDetector.order(addresses)
+	}
 	var primaries, fallbacks []string
 	if d.dualStack() && network == "tcp" {
 		primaries, fallbacks = partition(addresses)
@@ -151,32 +277,42 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	}
 
 	var c net.Conn
+	var dialed string
 	if len(fallbacks) > 0 {
-		c, err = d.dialParallel(ctx, network, primaries, fallbacks)
+		c, dialed, err = d.dialParallel(ctx, network, primaries, fallbacks)
 	} else {
-		c, err = d.dialSerial(ctx, network, primaries)
+		c, dialed, err = d.dialSerial(ctx, network, primaries)
+	}
+	if err == nil && d.StickyCache != nil && ip == nil {
+		d.StickyCache.remember(address, addresses, dialed)
+	}
+	if tracker, ok := d.Selector.(connTracker); ok && err == nil {
+		c = &trackedConn{Conn: c, release: tracker.track(dialed)}
 	}
 	return c, err
 }
 
-func (d *Dialer) resolver() Resolver {
+// resolver returns the resolver to use for ctx, taking the overrides
+// in ctx into account.
+func (d *Dialer) resolver(ctx context.Context) Resolver {
+	r := Resolver(net.DefaultResolver)
 	if d.Resolver != nil {
-		return d.Resolver
+		r = d.Resolver
 	}
-	return net.DefaultResolver
+	return contextResolver(ctx, r)
 }
 
 func (d *Dialer) dualStack() bool {
 	return d.FallbackDelay >= 0
 }
 
-func (d *Dialer) dialSerial(ctx context.Context, network string, addresses []string) (net.Conn, error) {
+func (d *Dialer) dialSerial(ctx context.Context, network string, addresses []string) (net.Conn, string, error) {
 	var firstErr error
 	for i, addr := range addresses {
 		saddr := simpleAddr{addr: addr, network: network}
 		select {
 		case <-ctx.Done():
-			return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: saddr, Err: ctx.Err()}
+			return nil, "", &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: saddr, Err: ctx.Err()}
 		default:
 		}
 		deadline, _ := ctx.Deadline()
@@ -194,9 +330,9 @@ func (d *Dialer) dialSerial(ctx context.Context, network string, addresses []str
 			dialCtx, cancel = context.WithDeadline(ctx, partialDeadline)
 			defer cancel()
 		}
-		c, err := d.dialer().DialContext(dialCtx, network, addr)
+		c, err := d.dialAddr(ctx, dialCtx, network, addr)
 		if err == nil {
-			return c, nil
+			return c, addr, nil
 		}
 		if firstErr == nil {
 			firstErr = err
@@ -205,20 +341,56 @@ func (d *Dialer) dialSerial(ctx context.Context, network string, addresses []str
 	if firstErr == nil {
 		firstErr = &net.OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: errMissingAddress}
 	}
-	return nil, firstErr
+	return nil, "", firstErr
+}
+
+// dialAddr dials a single resolved address with dialCtx, which is
+// derived from ctx for the address.
+func (d *Dialer) dialAddr(ctx, dialCtx context.Context, network, addr string) (net.Conn, error) {
+	if d.IPPolicy != nil && !isTrusted(ctx) {
+		err := d.IPPolicy.Check(addr)
+		if err != nil {
+			saddr := simpleAddr{addr: addr, network: network}
+			return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: saddr, Err: err}
+		}
+	}
+	if d.Limiter != nil {
+		releaseDial, releaseConn, err := d.Limiter.acquireIP(dialCtx, addr)
+		if err != nil {
+			saddr := simpleAddr{addr: addr, network: network}
+			return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: saddr, Err: err}
+		}
+		defer releaseDial()
+		c, err := d.dialer().DialContext(dialCtx, network, addr)
+		d.report(ctx, addr, err)
+		return limitedConn(c, err, releaseConn)
+	}
+	c, err := d.dialer().DialContext(dialCtx, network, addr)
+	d.report(ctx, addr, err)
+	return c, err
+}
+
+// report passes the result of a dial to the OutlierDetector.
+func (d *Dialer) report(ctx context.Context, addr string, err error) {
+	// Failures caused by the caller giving up, or by the other
+	// racer winning, say nothing about the address.
+	if d.OutlierDetector != nil && (err == nil || ctx.Err() == nil) {
+		d.OutlierDetector.report(addr, err)
+	}
 }
 
 // dialParallel races two copies of dialSerial, giving the first a
-// head start. It returns the first established connection and
-// closes the others. Otherwise it returns an error from the first
-// primary address.
-func (d *Dialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []string) (net.Conn, error) {
+// head start. It returns the first established connection along with
+// its address and closes the others. Otherwise it returns an error
+// from the first primary address.
+func (d *Dialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []string) (net.Conn, string, error) {
 	returned := make(chan struct{})
 	defer close(returned)
 
 	type dialResult struct {
 		net.Conn
 		error
+		addr    string
 		primary bool
 		done    bool
 	}
@@ -229,9 +401,9 @@ func (d *Dialer) dialParallel(ctx context.Context, network string, primaries, fa
 		if !primary {
 			ras = fallbacks
 		}
-		c, err := d.dialSerial(ctx, network, ras)
+		c, addr, err := d.dialSerial(ctx, network, ras)
 		select {
-		case results <- dialResult{Conn: c, error: err, primary: primary, done: true}:
+		case results <- dialResult{Conn: c, error: err, addr: addr, primary: primary, done: true}:
 		case <-returned:
 			if c != nil {
 				_ = c.Close()
@@ -259,7 +431,7 @@ func (d *Dialer) dialParallel(ctx context.Context, network string, primaries, fa
 
 		case res := <-results:
 			if res.error == nil {
-				return res.Conn, nil
+				return res.Conn, res.addr, nil
 			}
 			if res.primary {
 				primary = res
@@ -267,7 +439,7 @@ func (d *Dialer) dialParallel(ctx context.Context, network string, primaries, fa
 				fallback = res
 			}
 			if primary.done && fallback.done {
-				return nil, primary.error
+				return nil, "", primary.error
 			}
 			if res.primary && fallbackTimer.Stop() {
 				// If we were able to stop the timer, that means it
@@ -0,0 +1,583 @@
+package ara
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// An SRVResolver is a Resolver that can also look up SRV records.
+//
+// See net.Resolver.LookupSRV for a description of the parameters.
+type SRVResolver interface {
+	Resolver
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSServer serves the answers of a Resolver over the DNS protocol, so
+// that other processes, like the ones that cannot be given a Dialer,
+// see the same host overrides.
+//
+// It answers A and AAAA queries with the addresses the Resolver
+// returns, and the SRV, PTR, TXT, MX, NS and CNAME queries if the
+// Resolver is respectively an SRVResolver, a ReverseResolver, a
+// TXTResolver, an MXResolver, an NSResolver and a CNAMEResolver. Hosts
+// that are not found get NXDOMAIN responses, other lookup errors get
+// SERVFAIL responses. Responses that do not fit in a UDP message are
+// truncated, so that the clients retry over TCP.
+type DNSServer struct {
+	// Addr is the UDP and TCP address to listen on, like
+	// "127.0.0.1:5353", used by ListenAndServe.
+	Addr string
+
+	// Resolver answers the queries.
+	Resolver Resolver
+
+	// TTL is the time to live of the answers.
+	//
+	// If zero, a default of 1 minute is used.
+	TTL time.Duration
+
+	// Timeout limits the duration of each lookup.
+	//
+	// If zero, a default of 5 seconds is used.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	closed  bool
+	closers map[io.Closer]struct{}
+	serving sync.WaitGroup
+}
+
+// ErrServerClosed is returned by the Serve methods of a DNSServer after
+// a call to Close.
+var ErrServerClosed = errors.New("ara: DNS server closed")
+
+// ListenAndServe listens on both UDP and TCP at s.Addr and serves the
+// queries until Close is called, returning ErrServerClosed.
+func (s *DNSServer) ListenAndServe() error {
+	pc, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+	// Listen on the same port with TCP, which matters when Addr
+	// has no port.
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		_ = pc.Close()
+		return err
+	}
+	errs := make(chan error, 2)
+	go func() {
+		errs <- s.ServePacket(pc)
+	}()
+	go func() {
+		errs <- s.ServeListener(l)
+	}()
+	err = <-errs
+	if err != ErrServerClosed {
+		_ = pc.Close()
+		_ = l.Close()
+	}
+	<-errs
+	return err
+}
+
+// ServePacket serves the queries that arrive on pc, as with UDP,
+// until Close is called, returning ErrServerClosed.
+func (s *DNSServer) ServePacket(pc net.PacketConn) error {
+	if !s.track(pc) {
+		return ErrServerClosed
+	}
+	defer s.untrack(pc)
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go func() {
+			response := s.answer(query, false)
+			if response != nil {
+				_, _ = pc.WriteTo(response, addr)
+			}
+		}()
+	}
+}
+
+// ServeListener serves the queries that arrive on the connections
+// accepted from l, as with TCP, until Close is called, returning
+// ErrServerClosed.
+func (s *DNSServer) ServeListener(l net.Listener) error {
+	if !s.track(l) {
+		return ErrServerClosed
+	}
+	defer s.untrack(l)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		go func() {
+			defer s.untrack(conn)
+			serveDNSStream(conn, s.answer)
+		}()
+	}
+}
+
+// serveDNSStream answers the length prefixed queries on conn with
+// answer until conn is closed or idle for too long.
+func serveDNSStream(conn net.Conn, answer func(query []byte, stream bool) []byte) {
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var length [2]byte
+		_, err := io.ReadFull(conn, length[:])
+		if err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		_, err = io.ReadFull(conn, query)
+		if err != nil {
+			return
+		}
+		response := answer(query, true)
+		if response == nil {
+			return
+		}
+		_, err = conn.Write(append([]byte{byte(len(response) >> 8), byte(len(response))}, response...))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close stops the server, closing its listeners and connections, and
+// waits for them to be done.
+func (s *DNSServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var firstErr error
+	for c := range s.closers {
+		err := c.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.mu.Unlock()
+	s.serving.Wait()
+	return firstErr
+}
+
+// track registers c to be closed by Close. It reports false if the
+// server is already closed.
+func (s *DNSServer) track(c io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.closers == nil {
+		s.closers = make(map[io.Closer]struct{})
+	}
+	s.closers[c] = struct{}{}
+	s.serving.Add(1)
+	return true
+}
+
+// untrack closes c, which was registered with track, and forgets it.
+func (s *DNSServer) untrack(c io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.closers[c]; ok {
+		_ = c.Close()
+		delete(s.closers, c)
+		s.serving.Done()
+	}
+}
+
+func (s *DNSServer) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *DNSServer) answer(query []byte, stream bool) []byte {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return answerDNS(ctx, s.Resolver, uint32(ttl/time.Second), query, stream)
+}
+
+// maxUDPSize is the size of the UDP responses advertised in EDNS(0)
+// records, as recommended by the DNS flag day of 2020.
+const maxUDPSize = 1232
+
+// answerDNS returns the response to the DNS query, built with the
+// answers of r. It returns nil if the query is too malformed to be
+// answered. stream tells whether the response is sent over a stream,
+// where it is never truncated.
+func answerDNS(ctx context.Context, r Resolver, ttl uint32, query []byte, stream bool) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil || h.Response {
+		return nil
+	}
+	response := dnsmessage.Header{
+		ID:                 h.ID,
+		Response:           true,
+		OpCode:             h.OpCode,
+		Authoritative:      true,
+		RecursionDesired:   h.RecursionDesired,
+		RecursionAvailable: true,
+	}
+	if h.OpCode != 0 {
+		response.RCode = dnsmessage.RCodeNotImplemented
+		return buildDNS(response, nil, nil, 0)
+	}
+	q, err := p.Question()
+	if err != nil {
+		response.RCode = dnsmessage.RCodeFormatError
+		return buildDNS(response, nil, nil, 0)
+	}
+	maxSize := 65535
+	if !stream {
+		maxSize = udpSize(&p)
+	}
+	answers, rcode := lookupDNS(ctx, r, q, ttl)
+	response.RCode = rcode
+	return buildDNS(response, &q, answers, maxSize)
+}
+
+// udpSize returns the size of the UDP responses the client accepts,
+// reading its EDNS(0) record, if any, from p which is right after the
+// first question.
+func udpSize(p *dnsmessage.Parser) int {
+	const minSize = 512
+	if p.SkipAllQuestions() != nil || p.SkipAllAnswers() != nil || p.SkipAllAuthorities() != nil {
+		return minSize
+	}
+	for {
+		h, err := p.AdditionalHeader()
+		if err != nil {
+			return minSize
+		}
+		if h.Type == dnsmessage.TypeOPT {
+			// The class of an OPT record holds the size.
+			size := int(h.Class)
+			if size < minSize {
+				return minSize
+			}
+			if size > maxUDPSize {
+				return maxUDPSize
+			}
+			return size
+		}
+		if p.SkipAdditional() != nil {
+			return minSize
+		}
+	}
+}
+
+// dnsAnswer adds an answer to a response.
+type dnsAnswer func(b *dnsmessage.Builder) error
+
+// lookupDNS finds the answers to the question with r.
+func lookupDNS(ctx context.Context, r Resolver, q dnsmessage.Question, ttl uint32) ([]dnsAnswer, dnsmessage.RCode) {
+	name := strings.TrimSuffix(q.Name.String(), ".")
+	header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: ttl}
+	var answers []dnsAnswer
+	switch q.Type {
+	case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+		addrs, err := r.LookupHost(ctx, name)
+		if err != nil {
+			return nil, dnsErrorCode(err)
+		}
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				continue
+			}
+			if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+				var a dnsmessage.AResource
+				copy(a.A[:], ip4)
+				answers = append(answers, func(b *dnsmessage.Builder) error {
+					return b.AResource(header, a)
+				})
+			} else if ip4 == nil && q.Type == dnsmessage.TypeAAAA {
+				var aaaa dnsmessage.AAAAResource
+				copy(aaaa.AAAA[:], ip)
+				answers = append(answers, func(b *dnsmessage.Builder) error {
+					return b.AAAAResource(header, aaaa)
+				})
+			}
+		}
+		return answers, dnsmessage.RCodeSuccess
+	case dnsmessage.TypeSRV:
+		sr, ok := r.(SRVResolver)
+		labels := strings.SplitN(name, ".", 3)
+		if !ok || len(labels) != 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+			break
+		}
+		_, srvs, err := sr.LookupSRV(ctx, labels[0][1:], labels[1][1:], labels[2])
+		if err != nil {
+			return nil, dnsErrorCode(err)
+		}
+		for _, srv := range srvs {
+			target, err := dnsmessage.NewName(absDomainName(srv.Target))
+			if err != nil {
+				continue
+			}
+			resource := dnsmessage.SRVResource{Priority: srv.Priority, Weight: srv.Weight, Port: srv.Port, Target: target}
+			answers = append(answers, func(b *dnsmessage.Builder) error {
+				return b.SRVResource(header, resource)
+			})
+		}
+		return answers, dnsmessage.RCodeSuccess
+	case dnsmessage.TypePTR:
+		rr, ok := r.(ReverseResolver)
+		ip := parseReverseName(name)
+		if !ok || ip == nil {
+			break
+		}
+		names, err := rr.LookupAddr(ctx, ip.String())
+		if err != nil {
+			return nil, dnsErrorCode(err)
+		}
+		for _, host := range names {
+			ptr, err := dnsmessage.NewName(absDomainName(host))
+			if err != nil {
+				continue
+			}
+			resource := dnsmessage.PTRResource{PTR: ptr}
+			answers = append(answers, func(b *dnsmessage.Builder) error {
+				return b.PTRResource(header, resource)
+			})
+		}
+		return answers, dnsmessage.RCodeSuccess
+	case dnsmessage.TypeTXT:
+		tr, ok := r.(TXTResolver)
+		if !ok {
+			break
+		}
+		texts, err := tr.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, dnsErrorCode(err)
+		}
+		for _, text := range texts {
+			resource := dnsmessage.TXTResource{TXT: splitTXT(text)}
+			answers = append(answers, func(b *dnsmessage.Builder) error {
+				return b.TXTResource(header, resource)
+			})
+		}
+		return answers, dnsmessage.RCodeSuccess
+	case dnsmessage.TypeMX:
+		mr, ok := r.(MXResolver)
+		if !ok {
+			break
+		}
+		mxs, err := mr.LookupMX(ctx, name)
+		if err != nil {
+			return nil, dnsErrorCode(err)
+		}
+		for _, mx := range mxs {
+			host, err := dnsmessage.NewName(absDomainName(mx.Host))
+			if err != nil {
+				continue
+			}
+			resource := dnsmessage.MXResource{Pref: mx.Pref, MX: host}
+			answers = append(answers, func(b *dnsmessage.Builder) error {
+				return b.MXResource(header, resource)
+			})
+		}
+		return answers, dnsmessage.RCodeSuccess
+	case dnsmessage.TypeNS:
+		nr, ok := r.(NSResolver)
+		if !ok {
+			break
+		}
+		nss, err := nr.LookupNS(ctx, name)
+		if err != nil {
+			return nil, dnsErrorCode(err)
+		}
+		for _, ns := range nss {
+			host, err := dnsmessage.NewName(absDomainName(ns.Host))
+			if err != nil {
+				continue
+			}
+			resource := dnsmessage.NSResource{NS: host}
+			answers = append(answers, func(b *dnsmessage.Builder) error {
+				return b.NSResource(header, resource)
+			})
+		}
+		return answers, dnsmessage.RCodeSuccess
+	case dnsmessage.TypeCNAME:
+		cr, ok := r.(CNAMEResolver)
+		if !ok {
+			break
+		}
+		cname, err := cr.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, dnsErrorCode(err)
+		}
+		target, err := dnsmessage.NewName(absDomainName(cname))
+		if err != nil || strings.EqualFold(target.String(), absDomainName(name)) {
+			// A name that is not an alias has no CNAME record.
+			return nil, dnsmessage.RCodeSuccess
+		}
+		resource := dnsmessage.CNAMEResource{CNAME: target}
+		answers = append(answers, func(b *dnsmessage.Builder) error {
+			return b.CNAMEResource(header, resource)
+		})
+		return answers, dnsmessage.RCodeSuccess
+	}
+	// Tell apart the hosts that do not exist from the ones that
+	// have no records of the type.
+	_, err := r.LookupHost(ctx, name)
+	if err != nil {
+		return nil, dnsErrorCode(err)
+	}
+	return nil, dnsmessage.RCodeSuccess
+}
+
+// splitTXT splits text into the strings of at most 255 bytes that a TXT
+// record holds.
+func splitTXT(text string) []string {
+	var parts []string
+	for len(text) > 255 {
+		parts = append(parts, text[:255])
+		text = text[255:]
+	}
+	return append(parts, text)
+}
+
+// parseReverseName returns the IP address of a reverse lookup name,
+// like 1.0.0.127.in-addr.arpa, or nil if name is not one.
+func parseReverseName(name string) net.IP {
+	name = strings.ToLower(name)
+	var labels []string
+	var ip net.IP
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels = strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		ip = make(net.IP, net.IPv4len)
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return nil
+			}
+			ip[len(ip)-1-i] = byte(n)
+		}
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		labels = strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(labels) != 2*net.IPv6len {
+			return nil
+		}
+		ip = make(net.IP, net.IPv6len)
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return nil
+			}
+			ip[len(ip)-1-i/2] |= byte(n) << (4 * uint(i%2))
+		}
+	}
+	return ip
+}
+
+// dnsErrorCode returns the response code for a lookup error.
+func dnsErrorCode(err error) dnsmessage.RCode {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return dnsmessage.RCodeNameError
+	}
+	return dnsmessage.RCodeServerFailure
+}
+
+// buildDNS builds a response with the question and answers, dropping
+// the answers and setting the truncated bit if it exceeds maxSize.
+func buildDNS(h dnsmessage.Header, q *dnsmessage.Question, answers []dnsAnswer, maxSize int) []byte {
+	msg, err := buildDNSMessage(h, q, answers)
+	if err == nil && (maxSize == 0 || len(msg) <= maxSize) {
+		return msg
+	}
+	if err != nil {
+		h.RCode = dnsmessage.RCodeServerFailure
+	} else {
+		h.Truncated = true
+	}
+	msg, err = buildDNSMessage(h, q, nil)
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+func buildDNSMessage(h dnsmessage.Header, q *dnsmessage.Question, answers []dnsAnswer) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, h)
+	b.EnableCompression()
+	if q != nil {
+		err := b.StartQuestions()
+		if err != nil {
+			return nil, err
+		}
+		err = b.Question(*q)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := b.StartAnswers()
+	if err != nil {
+		return nil, err
+	}
+	for _, answer := range answers {
+		err = answer(&b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// absDomainName returns name with a trailing dot.
+func absDomainName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
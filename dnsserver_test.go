@@ -0,0 +1,97 @@
+package ara_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+type srvResolver struct {
+	ara.ReverseResolver
+}
+
+func (srvResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "http" || proto != "tcp" || name != "example.com" {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return "_http._tcp.example.com.", []*net.SRV{{Target: "www.example.com.", Port: 8080, Priority: 1, Weight: 1}}, nil
+}
+
+func TestDNSServer(t *testing.T) {
+	many := make([]string, 100)
+	for i := range many {
+		many[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	server := &ara.DNSServer{
+		Resolver: srvResolver{ara.NewCustomResolver(map[string][]string{
+			"example.com":         {"127.0.0.1", "::1"},
+			"blocked.example.com": {},
+			"many.example.com":    many,
+		}).(ara.ReverseResolver)},
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		_ = pc.Close()
+		t.Skip(err)
+	}
+	done := make(chan error, 2)
+	go func() {
+		done <- server.ServePacket(pc)
+	}()
+	go func() {
+		done <- server.ServeListener(listener)
+	}()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, pc.LocalAddr().String())
+		},
+	}
+	ctx := context.Background()
+
+	addrs, err := resolver.LookupHost(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Errorf("wrong addresses %v", addrs)
+	}
+	_, err = resolver.LookupHost(ctx, "blocked.example.com")
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found error for a blocked host, got %v", err)
+	}
+	// The answers do not fit in a UDP message, so they are fetched
+	// over TCP.
+	addrs, err = resolver.LookupHost(ctx, "many.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != len(many) {
+		t.Errorf("got %d addresses instead of %d", len(addrs), len(many))
+	}
+	_, srvs, err := resolver.LookupSRV(ctx, "http", "tcp", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srvs) != 1 || srvs[0].Target != "www.example.com." || srvs[0].Port != 8080 {
+		t.Errorf("wrong SRV records %v", srvs)
+	}
+
+	err = server.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != ara.ErrServerClosed {
+			t.Errorf("expected ErrServerClosed, got %v", err)
+		}
+	}
+}
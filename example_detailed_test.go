@@ -18,7 +18,7 @@ func (r resolver) LookupHost(ctx context.Context, host string) ([]string, error)
 	return []string{"127.0.0.1"}, nil
 }
 
-func ExampleDetailed() {
+func Example_detailed() {
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		log.Fatal(err)
@@ -11,14 +11,18 @@ import (
 )
 
 func ExampleNewClient() {
-	server := &http.Server{Addr: "127.0.0.1:80", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte("Alo?"))
 		if err != nil {
 			log.Fatal(err)
 		}
 	})}
 	go func() {
-		_ = server.ListenAndServe()
+		_ = server.Serve(listener)
 	}()
 	defer func() {
 		err := server.Shutdown(context.Background())
@@ -27,21 +31,32 @@ func ExampleNewClient() {
 		}
 	}()
 	client := ara.NewClient(ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}))
-	res, _ := client.Get("http://example.com")
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := client.Get("http://example.com:" + port)
+	if err != nil {
+		log.Fatal(err)
+	}
 	body, _ := ioutil.ReadAll(res.Body)
 	fmt.Println(string(body))
 	// Output: Alo?
 }
 
 func ExampleNewTransport() {
-	server := &http.Server{Addr: "127.0.0.1:80", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte("Alo?"))
 		if err != nil {
 			log.Fatal(err)
 		}
 	})}
 	go func() {
-		_ = server.ListenAndServe()
+		_ = server.Serve(listener)
 	}()
 	defer func() {
 		err := server.Shutdown(context.Background())
@@ -52,18 +67,25 @@ func ExampleNewTransport() {
 	client := &http.Client{
 		Transport: ara.NewTransport(ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}})),
 	}
-	res, _ := client.Get("http://example.com")
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := client.Get("http://example.com:" + port)
+	if err != nil {
+		log.Fatal(err)
+	}
 	body, _ := ioutil.ReadAll(res.Body)
 	fmt.Println(string(body))
 	// Output: Alo?
 }
 
 func ExampleDialer() {
+	listener, err := net.Listen("tcp", "127.0.0.1:1919")
+	if err != nil {
+		log.Fatal(err)
+	}
 	go func() {
-		listener, err := net.Listen("tcp", "127.0.0.1:1919")
-		if err != nil {
-			log.Fatal(err)
-		}
 		conn, err := listener.Accept()
 		if err != nil {
 			log.Fatal(err)
@@ -0,0 +1,367 @@
+package ara
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A Fault is a failure injected by a FaultyResolver or a FaultyDialer.
+type Fault int
+
+const (
+	// FaultNone injects no failure, only the latency of the rule.
+	FaultNone Fault = iota
+
+	// FaultNotFound makes lookups and dials fail as for a host that
+	// does not exist, as with NXDOMAIN responses.
+	FaultNotFound
+
+	// FaultTemporary makes lookups and dials fail with a temporary
+	// DNS error, as with SERVFAIL responses.
+	FaultTemporary
+
+	// FaultTimeout makes lookups and dials fail right away with a
+	// timeout error.
+	FaultTimeout
+
+	// FaultRefused makes dials fail as if the connection is refused,
+	// and lookups as if the DNS server refuses the query.
+	FaultRefused
+
+	// FaultBlackHole makes lookups and dials hang until their
+	// context is done, as with packets that are silently dropped.
+	// The dials of a FaultyDialer also time out with the Timeout and
+	// the Deadline of its Dialer, if it is a Dialer or a net.Dialer.
+	FaultBlackHole
+)
+
+// FaultRule describes the faults injected for the hosts it matches.
+type FaultRule struct {
+	// Pattern is matched against the host names as in HostRule, like
+	// ".example.com" for example.com and all of its subdomains. An
+	// empty pattern matches every host.
+	Pattern string
+
+	// Latency is added to every lookup or dial, whether it fails or
+	// not.
+	Latency time.Duration
+
+	// Jitter is the maximum random duration added to Latency.
+	Jitter time.Duration
+
+	// Fault is the failure to inject.
+	Fault Fault
+
+	// Rate is the probability, between 0 and 1, that a lookup or a
+	// dial fails with Fault.
+	//
+	// If zero, every lookup or dial fails.
+	Rate float64
+
+	// Up and Down, if Down is set, make the host flap: it works for
+	// Up, then fails with Fault for Down, and so on, starting from
+	// the first lookup or dial of the FaultyResolver or FaultyDialer.
+	// Rate applies during the Down periods only.
+	Up   time.Duration
+	Down time.Duration
+}
+
+// faults injects the faults of a list of rules. The zero value is
+// ready to use.
+type faults struct {
+	mu    sync.Mutex
+	rand  *rand.Rand
+	start time.Time
+}
+
+// inject waits for the latency of the first rule that matches host and
+// returns the fault to inject, if any.
+func (f *faults) inject(ctx context.Context, rules []FaultRule, seed int64, host string) (Fault, error) {
+	var rule *FaultRule
+	for i := range rules {
+		if matchPattern(rules[i].Pattern, host) {
+			rule = &rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return FaultNone, nil
+	}
+	f.mu.Lock()
+	if f.rand == nil {
+		f.rand = rand.New(rand.NewSource(seed))
+		f.start = time.Now()
+	}
+	latency := rule.Latency
+	if rule.Jitter > 0 {
+		latency += time.Duration(f.rand.Int63n(int64(rule.Jitter)))
+	}
+	fail := rule.Rate <= 0 || f.rand.Float64() < rule.Rate
+	elapsed := time.Since(f.start)
+	f.mu.Unlock()
+	if rule.Down > 0 && elapsed%(rule.Up+rule.Down) < rule.Up {
+		fail = false
+	}
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return FaultNone, ctx.Err()
+		}
+	}
+	if !fail {
+		return FaultNone, nil
+	}
+	if rule.Fault == FaultBlackHole {
+		<-ctx.Done()
+		return FaultBlackHole, ctx.Err()
+	}
+	return rule.Fault, nil
+}
+
+// matchPattern reports whether host matches pattern as in HostRule, or
+// pattern is empty.
+func matchPattern(pattern, host string) bool {
+	name := normalizeHostLoosely(host)
+	return pattern == "" || (&HostRule{Pattern: pattern}).matchHost(name)
+}
+
+// FaultyResolver wraps a Resolver to inject faults in its lookups, to
+// test how clients handle slow and failing name resolution.
+//
+// The lookups of records, like LookupTXT, fail as LookupHost does, and
+// are passed to the wrapped Resolver if it can make them, so that a
+// FaultyResolver can stand in for it, as with NetResolver or DNSServer.
+// The rules are matched against the looked up name, or the address of
+// LookupAddr.
+//
+// The faults are random, but a FaultyResolver used with the same Seed
+// and the same sequence of lookups injects the same faults.
+type FaultyResolver struct {
+	// Resolver makes the lookups that do not fail.
+	//
+	// If nil, net.DefaultResolver is used.
+	Resolver Resolver
+
+	// Rules lists the faults to inject. For each lookup, the first
+	// rule that matches the host applies.
+	Rules []FaultRule
+
+	// Seed seeds the random faults.
+	Seed int64
+
+	faults faults
+}
+
+// LookupHost looks up host with r.Resolver, after injecting the faults
+// of the rule that matches host.
+func (r *FaultyResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := r.inject(ctx, host); err != nil {
+		return nil, err
+	}
+	if r.Resolver == nil {
+		return systemResolver().LookupHost(ctx, host)
+	}
+	return r.Resolver.LookupHost(ctx, host)
+}
+
+// LookupAddr looks up the names of addr with r.Resolver, after
+// injecting the faults of the rule that matches addr.
+func (r *FaultyResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if err := r.inject(ctx, addr); err != nil {
+		return nil, err
+	}
+	if r.Resolver == nil {
+		return systemResolver().LookupAddr(ctx, addr)
+	}
+	if reverse, ok := r.Resolver.(ReverseResolver); ok {
+		return reverse.LookupAddr(ctx, addr)
+	}
+	return nil, unsupportedLookupError("PTR", addr)
+}
+
+// LookupTXT looks up the TXT records of name with r.Resolver, after
+// injecting the faults of the rule that matches name.
+func (r *FaultyResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if err := r.inject(ctx, name); err != nil {
+		return nil, err
+	}
+	if r.Resolver == nil {
+		return systemResolver().LookupTXT(ctx, name)
+	}
+	if txt, ok := r.Resolver.(TXTResolver); ok {
+		return txt.LookupTXT(ctx, name)
+	}
+	return nil, unsupportedLookupError("TXT", name)
+}
+
+// LookupMX looks up the MX records of name with r.Resolver, after
+// injecting the faults of the rule that matches name.
+func (r *FaultyResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if err := r.inject(ctx, name); err != nil {
+		return nil, err
+	}
+	if r.Resolver == nil {
+		return systemResolver().LookupMX(ctx, name)
+	}
+	if mx, ok := r.Resolver.(MXResolver); ok {
+		return mx.LookupMX(ctx, name)
+	}
+	return nil, unsupportedLookupError("MX", name)
+}
+
+// LookupCNAME looks up the canonical name of host with r.Resolver,
+// after injecting the faults of the rule that matches host.
+func (r *FaultyResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if err := r.inject(ctx, host); err != nil {
+		return "", err
+	}
+	if r.Resolver == nil {
+		return systemResolver().LookupCNAME(ctx, host)
+	}
+	if cname, ok := r.Resolver.(CNAMEResolver); ok {
+		return cname.LookupCNAME(ctx, host)
+	}
+	return "", unsupportedLookupError("CNAME", host)
+}
+
+// LookupNS looks up the NS records of name with r.Resolver, after
+// injecting the faults of the rule that matches name.
+func (r *FaultyResolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	if err := r.inject(ctx, name); err != nil {
+		return nil, err
+	}
+	if r.Resolver == nil {
+		return systemResolver().LookupNS(ctx, name)
+	}
+	if ns, ok := r.Resolver.(NSResolver); ok {
+		return ns.LookupNS(ctx, name)
+	}
+	return nil, unsupportedLookupError("NS", name)
+}
+
+// LookupSRV looks up the SRV records of the service with r.Resolver,
+// after injecting the faults of the rule that matches name.
+func (r *FaultyResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if err := r.inject(ctx, name); err != nil {
+		return "", nil, err
+	}
+	if r.Resolver == nil {
+		return systemResolver().LookupSRV(ctx, service, proto, name)
+	}
+	if srv, ok := r.Resolver.(SRVResolver); ok {
+		return srv.LookupSRV(ctx, service, proto, name)
+	}
+	return "", nil, unsupportedLookupError("SRV", name)
+}
+
+// inject injects the faults of the rule that matches name and returns
+// the error of the lookup, if it fails.
+func (r *FaultyResolver) inject(ctx context.Context, name string) error {
+	fault, err := r.faults.inject(ctx, r.Rules, r.Seed, name)
+	if err != nil {
+		return &net.DNSError{Err: err.Error(), Name: name, IsTimeout: err == context.DeadlineExceeded}
+	}
+	switch fault {
+	case FaultNotFound:
+		return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	case FaultTemporary:
+		return &net.DNSError{Err: "server misbehaving", Name: name, IsTemporary: true}
+	case FaultTimeout:
+		return &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true, IsTemporary: true}
+	case FaultRefused:
+		return &net.DNSError{Err: "query refused", Name: name, IsTemporary: true}
+	}
+	return nil
+}
+
+// A ContextDialer dials addresses, like a Dialer or a net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// FaultyDialer wraps a ContextDialer to inject faults in its dials, to
+// test how clients handle unreachable and failing servers.
+//
+// The rules are matched against the host of the dialed address, before
+// it is resolved. The faults are random, but a FaultyDialer used with
+// the same Seed and the same sequence of dials injects the same faults.
+type FaultyDialer struct {
+	// Dialer makes the dials that do not fail.
+	//
+	// If nil, a zero Dialer is used.
+	Dialer ContextDialer
+
+	// Rules lists the faults to inject. For each dial, the first rule
+	// that matches the host applies.
+	Rules []FaultRule
+
+	// Seed seeds the random faults.
+	Seed int64
+
+	faults faults
+}
+
+// DialContext dials address with d.Dialer, after injecting the faults
+// of the rule that matches its host.
+func (d *FaultyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ctx, cancel := d.dialContext(ctx)
+	defer cancel()
+	fault, err := d.faults.inject(ctx, d.Rules, d.Seed, host)
+	if err == context.DeadlineExceeded {
+		err = timeoutErr{}
+	}
+	if err == nil {
+		switch fault {
+		case FaultNotFound:
+			err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		case FaultTemporary:
+			err = &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+		case FaultTimeout:
+			err = timeoutErr{}
+		case FaultRefused:
+			err = os.NewSyscallError("connect", syscall.ECONNREFUSED)
+		}
+	}
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: simpleAddr{addr: address, network: network}, Err: err}
+	}
+	if d.Dialer == nil {
+		return (&Dialer{}).DialContext(ctx, network, address)
+	}
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+// dialContext returns ctx bounded by the Timeout and the Deadline of
+// d.Dialer, if it is a Dialer or a net.Dialer, so that the injected
+// faults and latencies count against them as a slow network would.
+func (d *FaultyDialer) dialContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	var timeout time.Duration
+	var deadline time.Time
+	switch dialer := d.Dialer.(type) {
+	case *Dialer:
+		timeout, deadline = dialer.Timeout, dialer.Deadline
+	case *net.Dialer:
+		timeout, deadline = dialer.Timeout, dialer.Deadline
+	}
+	if timeout > 0 {
+		if t := time.Now().Add(timeout); deadline.IsZero() || t.Before(deadline) {
+			deadline = t
+		}
+	}
+	if deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline)
+}
@@ -0,0 +1,161 @@
+package ara_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestFaultyResolver(t *testing.T) {
+	hosts := ara.NewCustomResolver(map[string][]string{
+		"example.com":     {"127.0.0.1"},
+		"api.example.com": {"127.0.0.1"},
+		"db.example.com":  {"127.0.0.1"},
+		"www.example.com": {"127.0.0.1"},
+		"flap.example":    {"127.0.0.1"},
+	})
+	rules := []ara.FaultRule{
+		{Pattern: "api.example.com", Fault: ara.FaultNotFound},
+		{Pattern: "db.example.com", Fault: ara.FaultTemporary},
+		{Pattern: "www.example.com", Fault: ara.FaultBlackHole},
+		{Pattern: "flap.example", Fault: ara.FaultTimeout, Up: time.Hour, Down: time.Hour},
+		{Pattern: ".example.com", Fault: ara.FaultTimeout, Rate: 0.5, Latency: 5 * time.Millisecond},
+	}
+	resolver := &ara.FaultyResolver{Resolver: hosts, Rules: rules, Seed: 1}
+	ctx := context.Background()
+
+	_, err := resolver.LookupHost(ctx, "API.example.com")
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	_, err = resolver.LookupHost(ctx, "db.example.com")
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsTemporary {
+		t.Errorf("expected a temporary error, got %v", err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	_, err = resolver.LookupHost(timeoutCtx, "www.example.com")
+	cancel()
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsTimeout {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	_, err = resolver.LookupHost(ctx, "flap.example")
+	if err != nil {
+		t.Errorf("lookup failed while the host is up: %v", err)
+	}
+
+	// The same seed injects the same faults.
+	lookups := func(seed int64) []bool {
+		resolver := &ara.FaultyResolver{Resolver: hosts, Rules: rules, Seed: seed}
+		var failed []bool
+		for i := 0; i < 10; i++ {
+			start := time.Now()
+			_, err := resolver.LookupHost(ctx, "example.com")
+			if time.Since(start) < 5*time.Millisecond {
+				t.Error("latency is not injected")
+			}
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+	first, second := lookups(42), lookups(42)
+	var failures int
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("faults differ with the same seed: %v and %v", first, second)
+		}
+		if first[i] {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Errorf("%d failures out of %d with a rate of 0.5", failures, len(first))
+	}
+}
+
+func TestFaultyDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := &ara.FaultyDialer{
+		Dialer: &ara.Dialer{Resolver: ara.NewCustomResolver(map[string][]string{
+			"example.com":     {"127.0.0.1"},
+			"api.example.com": {"127.0.0.1"},
+		})},
+		Rules: []ara.FaultRule{
+			{Pattern: "api.example.com", Fault: ara.FaultRefused},
+			{Pattern: "*.example.org", Fault: ara.FaultBlackHole},
+		},
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	_, err = dialer.DialContext(context.Background(), "tcp", "api.example.com:"+port)
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("expected a refused connection, got %v", err)
+	}
+	var syscallErr *os.SyscallError
+	if !errors.As(err, &syscallErr) {
+		t.Errorf("expected a syscall error, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = dialer.DialContext(ctx, "tcp", "www.example.org:"+port)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	// Black holes also time out with the Timeout of the Dialer.
+	dialer.Dialer = &ara.Dialer{Timeout: 10 * time.Millisecond}
+	start := time.Now()
+	_, err = dialer.DialContext(context.Background(), "tcp", "www.example.org:"+port)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dial with a 10ms timeout took %s", elapsed)
+	}
+}
+
+func TestFaultyResolverRecords(t *testing.T) {
+	custom := ara.NewCustomResolver(
+		map[string][]string{"example.com": {"127.0.0.1"}, "broken.example": {"127.0.0.1"}},
+		ara.WithTXT(map[string][]string{"example.com": {"v=spf1 -all"}}),
+	)
+	faulty := &ara.FaultyResolver{
+		Resolver: custom,
+		Rules:    []ara.FaultRule{{Pattern: "broken.example", Fault: ara.FaultNotFound}},
+	}
+	ctx := context.Background()
+	_, err := faulty.LookupTXT(ctx, "broken.example")
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	names, err := faulty.LookupAddr(ctx, "127.0.0.1")
+	if err != nil || len(names) != 2 {
+		t.Errorf("wrong names %v: %v", names, err)
+	}
+
+	// A FaultyResolver stands in for the resolver it wraps.
+	resolver := ara.NetResolver(faulty)
+	texts, err := resolver.LookupTXT(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 1 || texts[0] != "v=spf1 -all" {
+		t.Errorf("wrong TXT records over DNS %v", texts)
+	}
+}
@@ -0,0 +1,85 @@
+package ara
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	globalMu sync.Mutex
+
+	// installed maps the resolvers installed by InstallGlobal to the
+	// net.DefaultResolver they replaced.
+	installed = make(map[*net.Resolver]*net.Resolver)
+)
+
+// systemResolver returns net.DefaultResolver, or the one it replaced if
+// it was installed by InstallGlobal, for the fallbacks of the resolvers,
+// so that they do not loop through the installed resolver.
+func systemResolver() *net.Resolver {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	r := net.DefaultResolver
+	for {
+		previous, ok := installed[r]
+		if !ok {
+			return r
+		}
+		r = previous
+	}
+}
+
+// InstallGlobal makes r resolve the hosts for the whole process, for the
+// code that cannot be given a client or a resolver, like third-party
+// libraries creating their own http.Client{}, and returns a function
+// that undoes it.
+//
+// It replaces http.DefaultTransport with a copy that dials with a Dialer
+// using r, and net.DefaultResolver with NetResolver(r). The resolvers of
+// this package fall back to the net.DefaultResolver that was replaced,
+// rather than to NetResolver(r).
+//
+// It is meant for tests, like:
+//
+//	t.Cleanup(ara.InstallGlobal(resolver))
+//
+// The replaced variables are read without synchronization by the
+// standard library, so tests that install a resolver must not run in
+// parallel with other tests. The installations should be undone in the
+// reverse order; restore can be called more than once.
+func InstallGlobal(r Resolver) (restore func()) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	oldTransport := http.DefaultTransport
+	oldResolver := net.DefaultResolver
+	d := &Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Resolver:  r,
+	}
+	var transport *http.Transport
+	if t, ok := oldTransport.(*http.Transport); ok {
+		transport = t.Clone()
+		transport.DialContext = d.DialContext
+		transport.DialTLSContext = dialTLSFunc(d, transport)
+	} else {
+		transport = NewDialerTransport(d)
+	}
+	http.DefaultTransport = transport
+	resolver := NetResolver(r)
+	installed[resolver] = oldResolver
+	net.DefaultResolver = resolver
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			globalMu.Lock()
+			defer globalMu.Unlock()
+			transport.CloseIdleConnections()
+			delete(installed, resolver)
+			http.DefaultTransport = oldTransport
+			net.DefaultResolver = oldResolver
+		})
+	}
+}
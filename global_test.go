@@ -0,0 +1,89 @@
+package ara_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestInstallGlobal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, resolver := http.DefaultTransport, net.DefaultResolver
+
+	restore := ara.InstallGlobal(ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}))
+	client := &http.Client{}
+	response, err := client.Get("http://example.com:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "example.com:"+port {
+		t.Errorf("wrong response %q", body)
+	}
+	addrs, err := net.DefaultResolver.LookupHost(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("wrong addresses %v", addrs)
+	}
+	restore()
+	restore()
+
+	if http.DefaultTransport != transport {
+		t.Error("http.DefaultTransport is not restored")
+	}
+	if net.DefaultResolver != resolver {
+		t.Error("net.DefaultResolver is not restored")
+	}
+}
+
+func TestInstallGlobalFallback(t *testing.T) {
+	original := net.DefaultResolver
+	defer func() {
+		net.DefaultResolver = original
+	}()
+	net.DefaultResolver = ara.NetResolver(ara.NewCustomResolver(map[string][]string{"user.example": {"127.0.0.9"}}).(ara.ReverseResolver))
+
+	// The resolvers fall back to the replaced net.DefaultResolver.
+	lookup := func(r ara.Resolver) {
+		addrs, err := r.LookupHost(context.Background(), "user.example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "127.0.0.9" {
+			t.Errorf("wrong addresses %v", addrs)
+		}
+	}
+	lookup(ara.NewCustomResolver(nil))
+	lookup(ara.NewSplitResolver(nil, nil))
+
+	// And not to the resolver installed over it, which would loop.
+	installed := ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}})
+	restore := ara.InstallGlobal(installed)
+	defer restore()
+	lookup(installed)
+	lookup(net.DefaultResolver)
+}
@@ -1,3 +1,7 @@
 module github.com/cevatbarisyilmaz/ara
 
-go 1.13
+go 1.17
+
+require golang.org/x/net v0.11.0
+
+require golang.org/x/text v0.13.0 // indirect
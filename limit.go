@@ -0,0 +1,237 @@
+package ara
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// LimitError is returned by a Dialer when a dial is over one of the
+// limits of its Limiter and the Limiter fails fast.
+type LimitError struct {
+	// Limit is the name of the exceeded Limiter field.
+	Limit string
+
+	// Key is the host:port passed to the Dialer or the resolved
+	// address, whichever the limit applies to.
+	Key string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("ara: %s exceeded for %s", e.Limit, e.Key)
+}
+
+// Temporary reports true, as the limit may not be exceeded later on.
+func (e *LimitError) Temporary() bool {
+	return true
+}
+
+// Timeout reports false.
+func (e *LimitError) Timeout() bool {
+	return false
+}
+
+// Limiter caps the connections and dials made by a Dialer.
+//
+// Hosts are the host:port addresses passed to Dialer.DialContext
+// and IPs are the resolved addresses actually dialed. Open connections
+// are counted until they are closed.
+//
+// Dials that are over a limit wait until they are allowed, or until
+// their context is done, unless FailFast is set.
+//
+// A Limiter is safe for concurrent use and can be shared between
+// multiple Dialers. The zero value has no limits.
+type Limiter struct {
+	// MaxConnsPerHost limits the number of open connections per host.
+	//
+	// Zero means no limit.
+	MaxConnsPerHost int
+
+	// MaxConnsPerIP limits the number of open connections per IP.
+	//
+	// Zero means no limit.
+	MaxConnsPerIP int
+
+	// MaxDialsPerHost limits the number of in-flight dials per host.
+	//
+	// Zero means no limit.
+	MaxDialsPerHost int
+
+	// MaxDialsPerIP limits the number of in-flight dials per IP.
+	//
+	// Zero means no limit.
+	MaxDialsPerIP int
+
+	// Rate is the number of new dials per second allowed per host.
+	//
+	// Zero means no limit.
+	Rate float64
+
+	// Burst is the number of dials per host that can be made at
+	// once before the Rate applies.
+	//
+	// If zero, a default of 1 is used.
+	Burst int
+
+	// FailFast makes the dials that are over a limit fail with a
+	// *LimitError right away instead of waiting.
+	FailFast bool
+
+	mu      sync.Mutex
+	counts  map[string]int
+	buckets map[string]*bucket
+	changed chan struct{}
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// acquire takes a slot of the named limit for the key, waiting if
+// necessary. It returns a function to give the slot back.
+func (l *Limiter) acquire(ctx context.Context, limit string, max int, key string) (func(), error) {
+	if max <= 0 {
+		return func() {}, nil
+	}
+	counter := limit + " " + key
+	for {
+		l.mu.Lock()
+		if l.counts[counter] < max {
+			if l.counts == nil {
+				l.counts = make(map[string]int)
+			}
+			l.counts[counter]++
+			l.mu.Unlock()
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					l.release(counter)
+				})
+			}, nil
+		}
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		if l.FailFast {
+			return nil, &LimitError{Limit: limit, Key: key}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (l *Limiter) release(counter string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counts[counter]--
+	if l.counts[counter] <= 0 {
+		delete(l.counts, counter)
+	}
+	if l.changed != nil {
+		// Wake up everyone waiting, they will compete for the slot.
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// wait takes a token from the bucket of the host, waiting for it if
+// necessary.
+func (l *Limiter) wait(ctx context.Context, host string) error {
+	if l.Rate <= 0 {
+		return nil
+	}
+	now := time.Now()
+	burst := float64(l.burst())
+	l.mu.Lock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	b := l.buckets[host]
+	if b == nil {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[host] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	if l.FailFast {
+		l.mu.Unlock()
+		return &LimitError{Limit: "Rate", Key: host}
+	}
+	// Reserve the next token and wait for it to arrive.
+	delay := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	b.tokens--
+	l.mu.Unlock()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return 1
+}
+
+// acquireHost takes the host level slots for a new connection. It
+// returns a function to release the dial slot once the dial is over
+// and another one to release the connection slot once the connection
+// is closed.
+func (l *Limiter) acquireHost(ctx context.Context, host string) (releaseDial, releaseConn func(), err error) {
+	return l.acquirePair(ctx, "MaxDialsPerHost", l.MaxDialsPerHost, "MaxConnsPerHost", l.MaxConnsPerHost, host)
+}
+
+// acquireIP is the counterpart of acquireHost for a resolved address.
+func (l *Limiter) acquireIP(ctx context.Context, address string) (releaseDial, releaseConn func(), err error) {
+	return l.acquirePair(ctx, "MaxDialsPerIP", l.MaxDialsPerIP, "MaxConnsPerIP", l.MaxConnsPerIP, address)
+}
+
+func (l *Limiter) acquirePair(ctx context.Context, dialLimit string, maxDials int, connLimit string, maxConns int, key string) (releaseDial, releaseConn func(), err error) {
+	releaseConn, err = l.acquire(ctx, connLimit, maxConns, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	releaseDial, err = l.acquire(ctx, dialLimit, maxDials, key)
+	if err != nil {
+		releaseConn()
+		return nil, nil, err
+	}
+	return releaseDial, releaseConn, nil
+}
+
+// limitedConn wraps c, if the dial succeeded, so that closing it
+// releases its connection slot. Otherwise it releases the slot
+// immediately.
+func limitedConn(c net.Conn, err error, releaseConn func()) (net.Conn, error) {
+	if err != nil {
+		releaseConn()
+		return nil, err
+	}
+	return &trackedConn{Conn: c, release: releaseConn}, nil
+}
@@ -0,0 +1,56 @@
+package ara_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestLimiter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := &ara.Limiter{MaxConnsPerHost: 1, FailFast: true}
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}),
+		Limiter:  limiter,
+	}
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+	var limitErr *ara.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected a limit error, got %v", err)
+	}
+	if limitErr.Limit != "MaxConnsPerHost" {
+		t.Errorf("wrong limit %s", limitErr.Limit)
+	}
+	limiter.FailFast = false
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = dialer.DialContext(ctx, "tcp", "example.com:"+port)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the dial to wait until the deadline, got %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = conn.Close()
+	}()
+	conn, err = dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
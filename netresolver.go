@@ -0,0 +1,33 @@
+package ara
+
+import (
+	"context"
+	"net"
+)
+
+// NetResolver returns a *net.Resolver that gets its answers from r, for
+// the libraries that accept only a *net.Resolver.
+//
+// The returned resolver uses the pure Go resolver of the net package,
+// whose DNS queries are answered in the process, as by a DNSServer,
+// without opening any socket. Like any *net.Resolver, it still looks
+// up the hosts in /etc/hosts first and applies the search domains of
+// /etc/resolv.conf to the names that are not fully qualified.
+func NetResolver(r Resolver) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			// The conn does not implement net.PacketConn, so the
+			// queries are exchanged as over TCP and the responses
+			// are never truncated.
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				serveDNSStream(server, func(query []byte, stream bool) []byte {
+					return answerDNS(ctx, r, 0, query, stream)
+				})
+			}()
+			return client, nil
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package ara_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestNetResolver(t *testing.T) {
+	many := make([]string, 100)
+	for i := range many {
+		many[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	resolver := ara.NetResolver(srvResolver{ara.NewCustomResolver(map[string][]string{
+		"example.com":         {"127.0.0.1"},
+		"blocked.example.com": {},
+		"many.example.com":    many,
+		"doc.example.com":     {"192.0.2.1"},
+	}).(ara.ReverseResolver)})
+	ctx := context.Background()
+	addrs, err := resolver.LookupHost(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("wrong addresses %v", addrs)
+	}
+	addrs, err = resolver.LookupHost(ctx, "many.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != len(many) {
+		t.Errorf("got %d addresses instead of %d", len(addrs), len(many))
+	}
+	_, err = resolver.LookupHost(ctx, "blocked.example.com")
+	if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+		t.Errorf("expected a not found error for a blocked host, got %v", err)
+	}
+	_, srvs, err := resolver.LookupSRV(ctx, "http", "tcp", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srvs) != 1 || srvs[0].Port != 8080 {
+		t.Errorf("wrong SRV records %v", srvs)
+	}
+	// 127.0.0.1 would be found in /etc/hosts.
+	names, err := resolver.LookupAddr(ctx, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "doc.example.com." {
+		t.Errorf("wrong names %v", names)
+	}
+
+	conn, err := (&net.Dialer{Resolver: resolver}).Dial("tcp", "example.com:0")
+	if err == nil {
+		_ = conn.Close()
+	}
+	if opErr, ok := err.(*net.OpError); !ok || opErr.Addr == nil || opErr.Addr.String() != "127.0.0.1:0" {
+		t.Errorf("expected a dial to 127.0.0.1, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package ara
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts host names to their ASCII form for lookups,
+// as described in UTS #46, allowing the underscores that are common
+// in service names.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+	idna.VerifyDNSLength(true),
+)
+
+// normalizeHost returns the canonical form of a host name: lowercase,
+// without a trailing dot and with the internationalized labels in
+// their punycode form. IP addresses are returned as they are.
+func normalizeHost(host string) (string, error) {
+	if isIPLiteral(host) {
+		return host, nil
+	}
+	name, err := idnaProfile.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return "", errors.New("invalid character " + strconv.QuoteRune(rune(c)) + " in host name")
+		}
+	}
+	return name, nil
+}
+
+// normalizeHosts returns a copy of the mapping with normalized host
+// names, both as keys and as aliases. The names that cannot be
+// normalized are kept as they are, lowercase and without a trailing
+// dot, so that they can still match in the same way.
+func normalizeHosts(hosts map[string][]string) map[string][]string {
+	normalized := make(map[string][]string, len(hosts))
+	for host, records := range hosts {
+		key := normalizeHostLoosely(host)
+		if _, ok := normalized[key]; !ok {
+			// Keep the hosts without addresses, they are blocked.
+			normalized[key] = nil
+		}
+		for _, record := range records {
+			normalized[key] = append(normalized[key], normalizeHostLoosely(record))
+		}
+	}
+	return normalized
+}
+
+func normalizeHostLoosely(host string) string {
+	name, err := normalizeHost(host)
+	if err != nil {
+		return strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+	return name
+}
+
+// normalizePattern returns the pattern of a host name, which may have
+// a leading dot and wildcards, with its labels normalized like host
+// names. The labels with wildcards and the ones that cannot be
+// normalized are only made lowercase.
+func normalizePattern(pattern string) string {
+	pattern = strings.TrimSuffix(pattern, ".")
+	if !strings.ContainsAny(pattern, "*?[") {
+		if name, err := normalizeHost(strings.TrimPrefix(pattern, ".")); err == nil {
+			if strings.HasPrefix(pattern, ".") {
+				return "." + name
+			}
+			return name
+		}
+	}
+	labels := strings.Split(pattern, ".")
+	for i, label := range labels {
+		if label == "" || strings.ContainsAny(label, "*?[") {
+			labels[i] = strings.ToLower(label)
+		} else {
+			labels[i] = normalizeHostLoosely(label)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// invalidHostError returns the error for a host name that cannot be
+// looked up.
+func invalidHostError(host string, err error) error {
+	return &net.DNSError{Err: "invalid host name: " + err.Error(), Name: host}
+}
+
+// HostError describes an invalid entry of a host mapping.
+type HostError struct {
+	// Host is the host name of the entry.
+	Host string
+
+	// Address is the invalid address, or empty if the host name
+	// itself is invalid.
+	Address string
+
+	// Err is the reason the entry is invalid.
+	Err error
+}
+
+func (e *HostError) Error() string {
+	if e.Address == "" {
+		return "invalid host " + strconv.Quote(e.Host) + ": " + e.Err.Error()
+	}
+	return "invalid address " + strconv.Quote(e.Address) + " for host " + strconv.Quote(e.Host) + ": " + e.Err.Error()
+}
+
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
+
+// HostsError lists every invalid entry found in a host mapping.
+type HostsError []*HostError
+
+func (e HostsError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "ara: " + strings.Join(messages, "; ")
+}
+
+// ParseHosts validates a host mapping, like map[host][]address, and
+// returns it in its canonical form, ready to be passed to
+// NewCustomResolver.
+//
+// Host names are normalized as the custom resolver does. IP addresses
+// are formatted in their canonical form, keeping the zones of IPv6
+// addresses. Link-local IPv6 addresses must have a zone, and addresses
+// must not have ports.
+//
+// If any entry is invalid, ParseHosts returns a HostsError listing
+// every invalid entry, sorted by host.
+func ParseHosts(hosts map[string][]string) (map[string][]string, error) {
+	parsed := make(map[string][]string, len(hosts))
+	var errs HostsError
+	for host, records := range hosts {
+		key, err := parseHost(host)
+		if err != nil {
+			errs = append(errs, &HostError{Host: host, Err: err})
+			continue
+		}
+		if _, ok := parsed[key]; !ok {
+			parsed[key] = nil
+		}
+		for _, record := range records {
+			address, err := parseAddress(record)
+			if err != nil {
+				errs = append(errs, &HostError{Host: host, Address: record, Err: err})
+				continue
+			}
+			parsed[key] = append(parsed[key], address)
+		}
+	}
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return errs[i].Host < errs[j].Host
+		})
+		return nil, errs
+	}
+	return parsed, nil
+}
+
+var (
+	errHostIsIP         = errors.New("host is an IP address, which is never looked up")
+	errEmptyAddress     = errors.New("empty address")
+	errAddressHasPort   = errors.New("address must not have a port")
+	errInvalidIPv4      = errors.New("invalid IPv4 address")
+	errInvalidIPv6      = errors.New("invalid IPv6 address")
+	errMissingZone      = errors.New("link-local IPv6 address needs a zone, like fe80::1%eth0")
+	errNumericTopDomain = errors.New("host name cannot end with a numeric label")
+)
+
+func parseHost(host string) (string, error) {
+	if isIPLiteral(host) {
+		return "", errHostIsIP
+	}
+	name, err := normalizeHost(host)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errors.New("empty host name")
+	}
+	return name, nil
+}
+
+// parseAddress validates and canonicalizes an address of a mapping,
+// which is either an IP address or the host name of an alias.
+func parseAddress(address string) (string, error) {
+	if address == "" {
+		return "", errEmptyAddress
+	}
+	if strings.IndexByte(address, ':') >= 0 {
+		ip, zone := address, ""
+		if i := strings.LastIndexByte(address, '%'); i >= 0 {
+			ip, zone = address[:i], address[i+1:]
+		}
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			if _, _, err := net.SplitHostPort(address); err == nil {
+				return "", errAddressHasPort
+			}
+			return "", errInvalidIPv6
+		}
+		if parsed.To4() == nil && parsed.IsLinkLocalUnicast() && zone == "" {
+			return "", errMissingZone
+		}
+		if zone != "" {
+			return parsed.String() + "%" + zone, nil
+		}
+		return parsed.String(), nil
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String(), nil
+	}
+	labels := strings.Split(strings.TrimSuffix(address, "."), ".")
+	if len(labels) >= 3 && isNumeric(labels[0]) && isNumeric(labels[1]) && isNumeric(labels[2]) {
+		// Most likely a mistyped IPv4 address, like 127.0.0.l.
+		return "", errInvalidIPv4
+	}
+	if isNumeric(labels[len(labels)-1]) {
+		return "", errNumericTopDomain
+	}
+	return parseHost(address)
+}
+
+func isNumeric(label string) bool {
+	if label == "" {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		if label[i] < '0' || label[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
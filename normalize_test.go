@@ -0,0 +1,38 @@
+package ara_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestParseHosts(t *testing.T) {
+	hosts, err := ara.ParseHosts(map[string][]string{
+		"Example.com.": {"127.0.0.1", "0:0::1", "fe80::1%eth0", "api-blue.internal"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"example.com": {"127.0.0.1", "::1", "fe80::1%eth0", "api-blue.internal"}}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("wrong mapping %v", hosts)
+	}
+
+	_, err = ara.ParseHosts(map[string][]string{
+		"a.example.com": {"127.0.0.l", "127.0.0.1:80"},
+		"b.example.com": {"fe80::1", "10.0.0.256"},
+		"127.0.0.1":     {"127.0.0.1"},
+		"c.example.com": {"::1"},
+	})
+	errs, ok := err.(ara.HostsError)
+	if !ok {
+		t.Fatalf("expected a HostsError, got %v", err)
+	}
+	if len(errs) != 5 {
+		t.Fatalf("expected 5 invalid entries, got %d: %v", len(errs), errs)
+	}
+	if errs[0].Host != "127.0.0.1" || errs[0].Address != "" {
+		t.Errorf("wrong first entry %v", errs[0])
+	}
+}
@@ -0,0 +1,144 @@
+package ara
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutlierDetector tracks dial failures per address and temporarily
+// ejects the addresses that keep failing.
+//
+// Ejected addresses are not skipped entirely, they are moved to the
+// end of the list so that they are only tried once every healthy
+// address has failed. When the ejection time is over, the address
+// takes its usual place again and is probed by the next dial. A
+// single failure on that probe ejects it again.
+//
+// An OutlierDetector is safe for concurrent use and can be shared
+// between multiple Dialers. The zero value is ready to use.
+type OutlierDetector struct {
+	// MaxFailures is the number of consecutive failures after which
+	// an address gets ejected.
+	//
+	// If zero, a default of 3 is used.
+	MaxFailures int
+
+	// EjectionTime is the length of time an address stays ejected
+	// before it is probed again.
+	//
+	// If zero, a default of 30 seconds is used.
+	EjectionTime time.Duration
+
+	mu    sync.Mutex
+	addrs map[string]*outlierState
+}
+
+type outlierState struct {
+	failures     int
+	ejectedUntil time.Time
+}
+
+// AddressStatus describes the state of an address tracked by an
+// OutlierDetector.
+type AddressStatus struct {
+	// Address is the dialed address in host:port form.
+	Address string
+
+	// Failures is the number of consecutive failed dials.
+	Failures int
+
+	// Ejected reports whether the address is currently ejected.
+	Ejected bool
+
+	// EjectedUntil is the point in time at which the address will
+	// be probed again. It is zero if the address was never ejected.
+	EjectedUntil time.Time
+}
+
+// Status returns the state of every address that has failed at least
+// once since its last successful dial, sorted by address.
+func (o *OutlierDetector) Status() []AddressStatus {
+	now := time.Now()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	statuses := make([]AddressStatus, 0, len(o.addrs))
+	for addr, state := range o.addrs {
+		statuses = append(statuses, AddressStatus{
+			Address:      addr,
+			Failures:     state.failures,
+			Ejected:      now.Before(state.ejectedUntil),
+			EjectedUntil: state.ejectedUntil,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Address < statuses[j].Address
+	})
+	return statuses
+}
+
+// Reinstate forgets the failures of the given address, putting it
+// back to its usual place immediately.
+func (o *OutlierDetector) Reinstate(address string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.addrs, address)
+}
+
+// order moves the currently ejected addresses to the end of the list,
+// keeping the relative order of both groups.
+func (o *OutlierDetector) order(addresses []string) []string {
+	now := time.Now()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.addrs) == 0 {
+		return addresses
+	}
+	healthy := make([]string, 0, len(addresses))
+	var ejected []string
+	for _, addr := range addresses {
+		state := o.addrs[addr]
+		if state != nil && now.Before(state.ejectedUntil) {
+			ejected = append(ejected, addr)
+		} else {
+			healthy = append(healthy, addr)
+		}
+	}
+	return append(healthy, ejected...)
+}
+
+// report records the result of a dial to the given address.
+func (o *OutlierDetector) report(address string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err == nil {
+		delete(o.addrs, address)
+		return
+	}
+	if o.addrs == nil {
+		o.addrs = make(map[string]*outlierState)
+	}
+	state := o.addrs[address]
+	if state == nil {
+		state = &outlierState{}
+		o.addrs[address] = state
+	}
+	state.failures++
+	if state.failures >= o.maxFailures() {
+		state.ejectedUntil = time.Now().Add(o.ejectionTime())
+	}
+}
+
+func (o *OutlierDetector) maxFailures() int {
+	if o.MaxFailures > 0 {
+		return o.MaxFailures
+	}
+	return 3
+}
+
+func (o *OutlierDetector) ejectionTime() time.Duration {
+	if o.EjectionTime > 0 {
+		return o.EjectionTime
+	}
+	return 30 * time.Second
+}
@@ -0,0 +1,59 @@
+package ara_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestOutlierDetector(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector := &ara.OutlierDetector{MaxFailures: 1}
+	dialer := ara.Dialer{
+		Resolver:        ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1", "127.0.0.2"}}),
+		OutlierDetector: detector,
+	}
+	for i := 0; i < 2; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+	}
+	statuses := detector.Status()
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 tracked address, got %d", len(statuses))
+	}
+	if statuses[0].Address != net.JoinHostPort("127.0.0.1", port) {
+		t.Errorf("wrong address %s", statuses[0].Address)
+	}
+	if !statuses[0].Ejected {
+		t.Error("address is not ejected")
+	}
+	if statuses[0].Failures != 1 {
+		t.Errorf("ejected address was dialed again, %d failures", statuses[0].Failures)
+	}
+	detector.Reinstate(statuses[0].Address)
+	if len(detector.Status()) != 0 {
+		t.Error("address is not reinstated")
+	}
+}
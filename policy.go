@@ -0,0 +1,310 @@
+package ara
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ForbiddenIPError is returned by a Dialer when the address it is about
+// to dial is rejected by its IPPolicy.
+type ForbiddenIPError struct {
+	// Address is the rejected address in host:port form.
+	Address string
+
+	// IP is the rejected IP, or nil if Address does not hold one.
+	IP net.IP
+
+	// Network is the denied network that contains IP, or nil if the
+	// address is rejected for another reason.
+	Network *net.IPNet
+
+	// Reason describes why the address is rejected.
+	Reason string
+}
+
+func (e *ForbiddenIPError) Error() string {
+	return fmt.Sprintf("ara: dialing %s is forbidden: %s", e.Address, e.Reason)
+}
+
+// DefaultDeniedNetworks lists the networks an IPPolicy denies unless
+// its NoDefaults field is set: the unspecified, loopback, private,
+// shared, link-local (including cloud metadata endpoints like
+// 169.254.169.254), multicast and other reserved ranges of IPv4 and
+// IPv6.
+var DefaultDeniedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b:1::/48",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+var (
+	nat64Prefix = mustParseCIDRs("64:ff9b::/96")[0]
+	sixToFour   = mustParseCIDRs("2002::/16")[0]
+	teredo      = mustParseCIDRs("2001::/32")[0]
+)
+
+// IPPolicy decides which IP addresses a Dialer may connect to, to
+// protect against server-side request forgery.
+//
+// The policy is checked against every address right before it is
+// dialed, after the resolution, so a host that resolves to an
+// allowed address once and to a forbidden one later, as with DNS
+// rebinding, cannot get around it.
+//
+// IPv4 addresses embedded in IPv6 ones, as with IPv4-mapped, NAT64,
+// 6to4 and IPv4-compatible addresses, are checked as IPv4 addresses
+// too. Teredo addresses are always denied, as the IPv4 address they
+// carry cannot be checked reliably.
+//
+// The zero value denies DefaultDeniedNetworks.
+type IPPolicy struct {
+	// Allow lists the networks that are allowed even if they are
+	// denied otherwise. If AllowOnly is set, no other network is
+	// allowed.
+	Allow []*net.IPNet
+
+	// Deny lists the networks that are denied in addition to
+	// DefaultDeniedNetworks.
+	Deny []*net.IPNet
+
+	// AllowOnly makes the policy deny every network that is not in
+	// Allow.
+	AllowOnly bool
+
+	// NoDefaults makes the policy not deny DefaultDeniedNetworks.
+	NoDefaults bool
+}
+
+// Check returns a *ForbiddenIPError if the policy rejects the address
+// in host:port form, otherwise nil.
+func (p *IPPolicy) Check(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &ForbiddenIPError{Address: address, Reason: "not an IP address"}
+	}
+	ips := []net.IP{ip}
+	if ip.To4() == nil {
+		switch {
+		case nat64Prefix.Contains(ip):
+			ips = append(ips, ip[12:16])
+		case sixToFour.Contains(ip):
+			ips = append(ips, ip[2:6])
+		case teredo.Contains(ip):
+			return &ForbiddenIPError{Address: address, IP: ip, Network: teredo, Reason: "Teredo address"}
+		case isIPv4Compatible(ip):
+			ips = append(ips, ip[12:16])
+		}
+	}
+	for _, ip := range ips {
+		err := p.check(address, ip)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *IPPolicy) check(address string, ip net.IP) error {
+	for _, network := range p.Allow {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if p.AllowOnly {
+		return &ForbiddenIPError{Address: address, IP: ip, Reason: "not in the allowed networks"}
+	}
+	for _, network := range p.Deny {
+		if network.Contains(ip) {
+			return &ForbiddenIPError{Address: address, IP: ip, Network: network, Reason: "in denied network " + network.String()}
+		}
+	}
+	if !p.NoDefaults {
+		for _, network := range DefaultDeniedNetworks {
+			if network.Contains(ip) {
+				return &ForbiddenIPError{Address: address, IP: ip, Network: network, Reason: "in denied network " + network.String()}
+			}
+		}
+	}
+	return nil
+}
+
+// isIPv4Compatible reports whether ip is a deprecated IPv4-compatible
+// IPv6 address, like ::192.0.2.1.
+func isIPv4Compatible(ip net.IP) bool {
+	for _, b := range ip[:12] {
+		if b != 0 {
+			return false
+		}
+	}
+	// Leave :: and ::1 to the regular checks.
+	return !ip.Equal(net.IPv6unspecified) && !ip.Equal(net.IPv6loopback)
+}
+
+var errPolicyRemoteResolve = errors.New("ara: IPPolicy cannot be enforced when the proxy resolves the hosts")
+
+var errPolicyTransportProxy = errors.New("ara: HostPolicy and IPPolicy cannot be enforced through the proxy of a transport, set the Proxy of the Dialer instead")
+
+type trustedKey struct{}
+
+// trusted returns a copy of ctx that marks the dials made with it as
+// exempt from the policies of the Dialer, as with the dials to the
+// proxy server that the user configured.
+func trusted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, trustedKey{}, true)
+}
+
+func isTrusted(ctx context.Context) bool {
+	t, _ := ctx.Value(trustedKey{}).(bool)
+	return t
+}
+
+// ForbiddenHostError is returned by a Dialer when the address it is
+// asked to dial is rejected by its HostPolicy.
+type ForbiddenHostError struct {
+	// Host and Port are the parts of the rejected address.
+	Host string
+	Port string
+
+	// Pattern is the pattern of the rule that rejected the address,
+	// or empty if the address matched no allowing rule.
+	Pattern string
+
+	// Reason describes why the address is rejected.
+	Reason string
+}
+
+func (e *ForbiddenHostError) Error() string {
+	return fmt.Sprintf("ara: dialing %s is forbidden: %s", net.JoinHostPort(e.Host, e.Port), e.Reason)
+}
+
+// HostRule matches host names, and optionally ports, for a HostPolicy.
+type HostRule struct {
+	// Pattern is matched against host names normalized as by the
+	// resolvers of this package: lowercase, without a trailing dot
+	// and with the internationalized labels in their punycode form.
+	// The pattern is normalized in the same way. A pattern that starts with a dot, like
+	// ".example.com", matches example.com and all of its
+	// subdomains. A pattern with wildcards, like "api-*.example.com",
+	// is matched as in path.Match. Any other pattern matches only the
+	// exact host name.
+	Pattern string
+
+	// Ports optionally limits the rule to the listed ports.
+	Ports []int
+}
+
+// matchHost reports whether the normalized host name matches the rule.
+func (r *HostRule) matchHost(host string) bool {
+	pattern := normalizePattern(r.Pattern)
+	switch {
+	case strings.HasPrefix(pattern, "."):
+		return host == pattern[1:] || strings.HasSuffix(host, pattern)
+	case strings.ContainsAny(pattern, "*?["):
+		matched, err := path.Match(pattern, host)
+		return err == nil && matched
+	default:
+		return host == pattern
+	}
+}
+
+func (r *HostRule) matchPort(port string) bool {
+	if len(r.Ports) == 0 {
+		return true
+	}
+	for _, p := range r.Ports {
+		if strconv.Itoa(p) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// HostPolicy decides which host names a Dialer may connect to. It is
+// checked before the host is resolved, so the hosts it rejects never
+// reach the Resolver.
+//
+// The zero value allows every host.
+type HostPolicy struct {
+	// Allow, if not empty, makes the policy reject the hosts that
+	// match none of the rules, and the ports that are not listed in
+	// the first rule that matches the host.
+	Allow []HostRule
+
+	// Deny lists the rules that reject the hosts and ports they
+	// match, even if they are allowed by Allow.
+	Deny []HostRule
+}
+
+// Check returns a *ForbiddenHostError if the policy rejects the address
+// in host:port form, otherwise nil. The host names that cannot be
+// normalized are rejected.
+func (p *HostPolicy) Check(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	name, err := normalizeHost(host)
+	if err != nil {
+		return &ForbiddenHostError{Host: host, Port: port, Reason: "invalid host name: " + err.Error()}
+	}
+	for _, rule := range p.Deny {
+		if rule.matchHost(name) && rule.matchPort(port) {
+			return &ForbiddenHostError{Host: host, Port: port, Pattern: rule.Pattern, Reason: "denied by " + rule.Pattern}
+		}
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, rule := range p.Allow {
+		if rule.matchHost(name) {
+			if rule.matchPort(port) {
+				return nil
+			}
+			return &ForbiddenHostError{Host: host, Port: port, Pattern: rule.Pattern, Reason: "port not allowed by " + rule.Pattern}
+		}
+	}
+	return &ForbiddenHostError{Host: host, Port: port, Reason: "host not allowed"}
+}
@@ -0,0 +1,206 @@
+package ara_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestIPPolicy(t *testing.T) {
+	policy := &ara.IPPolicy{}
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:80":            true,
+		"[2606:2800:220:1::1]:443":    true,
+		"127.0.0.1:80":                false,
+		"10.1.2.3:80":                 false,
+		"169.254.169.254:80":          false,
+		"[::1]:80":                    false,
+		"[fe80::1%eth0]:80":           false,
+		"[::ffff:127.0.0.1]:80":       false,
+		"[::ffff:169.254.169.254]:80": false,
+		"[64:ff9b::a9fe:a9fe]:80":     false,
+		"[2002:7f00:1::1]:80":         false,
+		"[::7f00:1]:80":               false,
+		"localhost:80":                false,
+	} {
+		err := policy.Check(address)
+		if allowed && err != nil {
+			t.Errorf("%s is denied: %v", address, err)
+		} else if !allowed && err == nil {
+			t.Errorf("%s is allowed", address)
+		}
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}),
+		IPPolicy: policy,
+	}
+	_, err = dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+	var forbidden *ara.ForbiddenIPError
+	if !errors.As(err, &forbidden) {
+		t.Fatalf("expected a forbidden IP error, got %v", err)
+	}
+	if !forbidden.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("wrong IP %s", forbidden.IP)
+	}
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	policy.Allow = []*net.IPNet{loopback}
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+type countingResolver struct {
+	lookups int
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups++
+	return []string{"127.0.0.1"}, nil
+}
+
+func TestHostPolicy(t *testing.T) {
+	policy := &ara.HostPolicy{
+		Allow: []ara.HostRule{
+			{Pattern: ".example.com", Ports: []int{443}},
+			{Pattern: "api-*.example.org"},
+		},
+		Deny: []ara.HostRule{
+			{Pattern: "admin.example.com"},
+		},
+	}
+	for address, allowed := range map[string]bool{
+		"example.com:443":          true,
+		"WWW.Example.COM.:443":     true,
+		"www.example.com:80":       false,
+		"admin.example.com:443":    false,
+		"api-eu.example.org:8080":  true,
+		"www.example.org:443":      false,
+		"example.net:443":          false,
+		"ａｄｍｉｎ.example.com:443":    false,
+		"bad name.example.com:443": false,
+	} {
+		err := policy.Check(address)
+		if allowed && err != nil {
+			t.Errorf("%s is denied: %v", address, err)
+		} else if !allowed && err == nil {
+			t.Errorf("%s is allowed", address)
+		}
+	}
+
+	resolver := &countingResolver{}
+	dialer := ara.Dialer{
+		Resolver:   resolver,
+		HostPolicy: policy,
+	}
+	_, err := dialer.DialContext(context.Background(), "tcp", "example.net:443")
+	var forbidden *ara.ForbiddenHostError
+	if !errors.As(err, &forbidden) {
+		t.Fatalf("expected a forbidden host error, got %v", err)
+	}
+	if resolver.lookups != 0 {
+		t.Error("forbidden host is resolved")
+	}
+
+	// The names are matched as the resolvers see them.
+	dialer = ara.Dialer{
+		Resolver:   ara.NewCustomResolver(map[string][]string{"evil.com": {"127.0.0.1"}}),
+		HostPolicy: &ara.HostPolicy{Deny: []ara.HostRule{{Pattern: ".evil.com"}}},
+	}
+	for _, host := range []string{"evil.com", "ｅｖｉｌ.com", "EVIL.com."} {
+		_, err = dialer.DialContext(context.Background(), "tcp", host+":443")
+		if !errors.As(err, &forbidden) {
+			t.Errorf("expected a forbidden host error for %s, got %v", host, err)
+		}
+	}
+}
+
+func TestPolicyTransportProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	policy := &ara.IPPolicy{Allow: []*net.IPNet{loopback}}
+	client := ara.NewClient(ara.NewCustomResolver(nil), ara.WithTransportOptions(
+		ara.WithDialer(func(d *ara.Dialer) {
+			d.IPPolicy = policy
+		}),
+		ara.WithProxy(http.ProxyURL(proxyURL)),
+	))
+	_, err = client.Get("http://169.254.169.254/latest/meta-data")
+	if err == nil {
+		t.Error("request through the proxy of the transport succeeded")
+	}
+	if atomic.LoadInt32(&proxied) != 0 {
+		t.Error("request reached the proxy")
+	}
+
+	// The targets are checked when the Dialer connects through the
+	// proxy.
+	client = ara.NewClient(ara.NewCustomResolver(nil), ara.WithTransportOptions(
+		ara.WithDialer(func(d *ara.Dialer) {
+			d.IPPolicy = policy
+			d.Proxy = &ara.HTTPProxy{Addr: proxyURL.Host}
+		}),
+		ara.WithProxy(nil),
+	))
+	_, err = client.Get("http://169.254.169.254/latest/meta-data")
+	var forbidden *ara.ForbiddenIPError
+	if !errors.As(err, &forbidden) {
+		t.Errorf("expected a forbidden IP error, got %v", err)
+	}
+	if atomic.LoadInt32(&proxied) != 0 {
+		t.Error("request reached the proxy")
+	}
+
+	hostPolicy := &ara.HostPolicy{Allow: []ara.HostRule{{Pattern: ".example.com"}}}
+	client = ara.NewClient(ara.NewCustomResolver(nil), ara.WithTransportOptions(
+		ara.WithDialer(func(d *ara.Dialer) {
+			d.HostPolicy = hostPolicy
+		}),
+		ara.WithProxy(http.ProxyURL(proxyURL)),
+	))
+	_, err = client.Get("http://internal.test/")
+	if err == nil {
+		t.Error("request through the proxy of the transport succeeded")
+	}
+	client = ara.NewClient(ara.NewCustomResolver(nil), ara.WithTransportOptions(
+		ara.WithDialer(func(d *ara.Dialer) {
+			d.HostPolicy = hostPolicy
+			d.Proxy = &ara.HTTPProxy{Addr: proxyURL.Host}
+		}),
+		ara.WithProxy(nil),
+	))
+	_, err = client.Get("http://internal.test/")
+	var forbiddenHost *ara.ForbiddenHostError
+	if !errors.As(err, &forbiddenHost) {
+		t.Errorf("expected a forbidden host error, got %v", err)
+	}
+	if atomic.LoadInt32(&proxied) != 0 {
+		t.Error("request reached the proxy")
+	}
+}
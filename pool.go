@@ -0,0 +1,172 @@
+package ara
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// PoolTransport is an http.RoundTripper that keeps a separate pool of
+// connections for every resolution of an overridden host.
+//
+// An http.Transport pools its connections by scheme and host, so a
+// connection dialed while a host was mapped to one address keeps being
+// reused after the mapping changes, or for requests that override the
+// mapping with WithHosts or WithResolver. For the hosts that are
+// overridden, PoolTransport resolves the host of every request first
+// and sends it through a transport that only dials the resolved
+// addresses, keyed by those addresses and the key set with
+// WithPoolKey.
+//
+// A host is overridden when the context of the request overrides it,
+// or when it is not resolved by the system: the resolvers of this
+// package that fall back to net.DefaultResolver only override the
+// hosts of their mappings, a *net.Resolver overrides no host, and any
+// other Resolver overrides every host. The requests to the hosts that
+// are not overridden share a single pool, as with an http.Transport,
+// so that hosts whose DNS answers rotate keep reusing their
+// connections.
+//
+// When the resolution of an overridden host changes, the idle
+// connections of its previous pool are closed and the pool is dropped.
+// Requests with different pool keys are tracked apart, so that tenants
+// with different mappings do not flush each other's pools.
+type PoolTransport struct {
+	dialer   *Dialer
+	template *http.Transport
+
+	mu      sync.Mutex
+	pools   map[string]*http.Transport
+	current map[string]string
+}
+
+// NewPoolTransport returns a *PoolTransport that uses the given resolver
+// while dialing. Its pools are configured like the transport returned
+// by NewTransport with the same options.
+func NewPoolTransport(r Resolver, opts ...TransportOption) *PoolTransport {
+	d, t := newTransport(r, opts)
+	return &PoolTransport{
+		dialer:   d,
+		template: t,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *PoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Hostname()
+	if !overridden(ctx, p.dialer.Resolver, host) {
+		return p.template.RoundTrip(req)
+	}
+	records, err := p.dialer.resolver(ctx).LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return p.pool(ctx, poolKey(ctx), host, records).RoundTrip(req)
+}
+
+// pool returns the transport for the requests to host with the given
+// pool key, creating it if necessary and dropping the previous one if
+// the records of the host have changed.
+func (p *PoolTransport) pool(ctx context.Context, key, host string, records []string) *http.Transport {
+	scope := key + "|" + host
+	id := scope + "|" + fingerprint(records)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if previous, ok := p.current[scope]; ok && previous != id {
+		if t := p.pools[previous]; t != nil {
+			t.CloseIdleConnections()
+			delete(p.pools, previous)
+		}
+	}
+	if p.current == nil {
+		p.current = make(map[string]string)
+		p.pools = make(map[string]*http.Transport)
+	}
+	p.current[scope] = id
+	t := p.pools[id]
+	if t == nil {
+		t = p.newPool(host, records)
+		p.pools[id] = t
+	}
+	return t
+}
+
+// newPool returns a transport that resolves host to records while
+// dialing.
+func (p *PoolTransport) newPool(host string, records []string) *http.Transport {
+	t := p.template.Clone()
+	pin := func(ctx context.Context) context.Context {
+		return WithHosts(ctx, map[string][]string{host: records})
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return p.dialer.DialContext(pin(ctx), network, addr)
+	}
+	t.DialTLSContext = dialTLSFunc(p.dialer, t)
+	return t
+}
+
+// Flush closes the idle connections of every pool of the given
+// overridden host and drops the pools.
+func (p *PoolTransport) Flush(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for scope, id := range p.current {
+		if scope[strings.LastIndexByte(scope, '|')+1:] != host {
+			continue
+		}
+		if t := p.pools[id]; t != nil {
+			t.CloseIdleConnections()
+			delete(p.pools, id)
+		}
+		delete(p.current, scope)
+	}
+}
+
+// CloseIdleConnections closes the idle connections of every pool.
+func (p *PoolTransport) CloseIdleConnections() {
+	p.template.CloseIdleConnections()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.pools {
+		t.CloseIdleConnections()
+	}
+}
+
+// A mappingResolver is a Resolver that can tell which hosts it
+// overrides the resolution of, and which ones it leaves to the system.
+type mappingResolver interface {
+	maps(name string) bool
+}
+
+// overrides reports whether r resolves the normalized host name other
+// than the system does.
+func overrides(r Resolver, name string) bool {
+	switch r := r.(type) {
+	case nil, *net.Resolver:
+		return false
+	case mappingResolver:
+		return r.maps(name)
+	}
+	return true
+}
+
+// overridden reports whether the resolution of host is overridden by
+// ctx or by r.
+func overridden(ctx context.Context, r Resolver, host string) bool {
+	name, err := normalizeHost(host)
+	if err != nil {
+		return false
+	}
+	for o, _ := ctx.Value(overrideKey{}).(*override); o != nil; o = o.parent {
+		if o.resolver != nil {
+			return true
+		}
+		if _, ok := o.hosts[name]; ok {
+			return true
+		}
+	}
+	return overrides(r, name)
+}
@@ -0,0 +1,139 @@
+package ara_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestPoolTransport(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(first.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		_ = first.Close()
+		t.Skip(err)
+	}
+	for _, listener := range []net.Listener{first, second} {
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, _ := net.SplitHostPort(r.Context().Value(http.LocalAddrContextKey).(net.Addr).String())
+			_, _ = w.Write([]byte(host))
+		})}
+		go func(listener net.Listener) {
+			_ = server.Serve(listener)
+		}(listener)
+		defer server.Close()
+	}
+	transport := ara.NewPoolTransport(
+		ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}),
+		ara.WithProxy(nil),
+	)
+	defer transport.CloseIdleConnections()
+	client := http.Client{Transport: transport}
+	get := func(ctx context.Context) string {
+		request, err := http.NewRequest(http.MethodGet, "http://example.com:"+port, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Do(request.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		return string(body)
+	}
+	tenant := ara.WithHosts(context.Background(), map[string][]string{"example.com": {"127.0.0.2"}})
+	for i := 0; i < 2; i++ {
+		if backend := get(context.Background()); backend != "127.0.0.1" {
+			t.Errorf("default mapping reached %s", backend)
+		}
+		if backend := get(tenant); backend != "127.0.0.2" {
+			t.Errorf("overridden mapping reached %s", backend)
+		}
+		if backend := get(ara.WithPoolKey(tenant, "tenant")); backend != "127.0.0.2" {
+			t.Errorf("overridden mapping with a pool key reached %s", backend)
+		}
+	}
+	transport.Flush("example.com")
+	if backend := get(context.Background()); backend != "127.0.0.1" {
+		t.Errorf("default mapping reached %s after flush", backend)
+	}
+
+	// The answers of other resolvers are tracked too.
+	switching := &switchingResolver{addr: "127.0.0.1"}
+	switchingTransport := ara.NewPoolTransport(switching, ara.WithProxy(nil))
+	defer switchingTransport.CloseIdleConnections()
+	client.Transport = switchingTransport
+	if backend := get(context.Background()); backend != "127.0.0.1" {
+		t.Errorf("resolver reached %s", backend)
+	}
+	switching.set("127.0.0.2")
+	if backend := get(context.Background()); backend != "127.0.0.2" {
+		t.Errorf("changed resolver reached %s", backend)
+	}
+}
+
+func TestPoolTransportSharedPool(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := ara.NewPoolTransport(ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}), ara.WithProxy(nil))
+	defer transport.CloseIdleConnections()
+	client := http.Client{Transport: transport}
+	for i := 0; i < 3; i++ {
+		response, err := client.Get("http://localhost:" + port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = ioutil.ReadAll(response.Body)
+		_ = response.Body.Close()
+	}
+	// Hosts that are resolved by the system share a pool.
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("expected 1 connection, got %d", n)
+	}
+}
+
+type switchingResolver struct {
+	mu   sync.Mutex
+	addr string
+}
+
+func (r *switchingResolver) set(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addr = addr
+}
+
+func (r *switchingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return []string{r.addr}, nil
+}
@@ -0,0 +1,113 @@
+package ara
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// A Proxy connects to targets through an intermediary server.
+type Proxy interface {
+	// Server returns the address of the proxy server in host:port
+	// form. Its host is resolved with the Resolver of the Dialer.
+	Server() string
+
+	// Connect asks the proxy, over conn, to connect to target,
+	// which is in host:port form. It returns the connection to use
+	// for talking to the target, which may be conn itself.
+	Connect(ctx context.Context, conn net.Conn, network, target string) (net.Conn, error)
+}
+
+// dialProxy connects to address through the Proxy of the Dialer.
+func (d *Dialer) dialProxy(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	targets := []string{address}
+	if d.RemoteResolve && d.IPPolicy != nil && net.ParseIP(host) == nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: simpleAddr{addr: address, network: network}, Err: errPolicyRemoteResolve}
+	}
+	if !d.RemoteResolve && net.ParseIP(host) == nil {
+		records, err := d.resolver(ctx).LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		targets = make([]string, len(records))
+		for i, record := range records {
+			targets[i] = net.JoinHostPort(record, port)
+		}
+	}
+	var firstErr error
+	for _, target := range targets {
+		c, err := d.dialProxyTarget(ctx, network, target)
+		if err == nil {
+			return c, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = &net.OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: errMissingAddress}
+	}
+	return nil, firstErr
+}
+
+// dialProxyTarget opens a new connection to the proxy server and asks
+// it to connect to target.
+func (d *Dialer) dialProxyTarget(ctx context.Context, network, target string) (net.Conn, error) {
+	if d.IPPolicy != nil {
+		err := d.IPPolicy.Check(target)
+		if err != nil {
+			saddr := simpleAddr{addr: target, network: network}
+			return nil, &net.OpError{Op: "dial", Net: network, Source: d.LocalAddr, Addr: saddr, Err: err}
+		}
+	}
+	// The proxy server is configured by the user, so the policies
+	// are for the targets only.
+	conn, err := d.dialDirect(trusted(ctx), "tcp", d.Proxy.Server())
+	if err != nil {
+		return nil, err
+	}
+	c, err := d.Proxy.Connect(ctx, conn, network, target)
+	if err != nil {
+		_ = conn.Close()
+		saddr := simpleAddr{addr: target, network: network}
+		return nil, &net.OpError{Op: "proxyconnect", Net: network, Source: d.LocalAddr, Addr: saddr, Err: err}
+	}
+	return c, nil
+}
+
+// aLongTimeAgo is a non-zero time, far in the past, used for immediate
+// cancellation of network operations.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// handshake runs fn, which talks over conn, making sure that it does
+// not outlive ctx.
+func handshake(ctx context.Context, conn net.Conn, fn func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+	err := fn()
+	close(done)
+	<-stopped
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return err
+}
@@ -0,0 +1,225 @@
+package ara
+
+import (
+	"context"
+	"net"
+)
+
+// A TXTResolver is a Resolver that can also look up TXT records.
+//
+// See net.Resolver.LookupTXT for a description of the parameters.
+type TXTResolver interface {
+	Resolver
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// An MXResolver is a Resolver that can also look up MX records.
+//
+// See net.Resolver.LookupMX for a description of the parameters.
+type MXResolver interface {
+	Resolver
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// A CNAMEResolver is a Resolver that can also look up canonical names.
+//
+// See net.Resolver.LookupCNAME for a description of the parameters.
+type CNAMEResolver interface {
+	Resolver
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// An NSResolver is a Resolver that can also look up NS records.
+//
+// See net.Resolver.LookupNS for a description of the parameters.
+type NSResolver interface {
+	Resolver
+	LookupNS(ctx context.Context, name string) ([]*net.NS, error)
+}
+
+// WithTXT sets the TXT records of the resolver, like
+// map[name][]text.
+func WithTXT(records map[string][]string) ResolverOption {
+	return func(r *resolver) {
+		r.txt = make(map[string][]string, len(records))
+		for name, texts := range records {
+			key := normalizeHostLoosely(name)
+			r.txt[key] = append(r.txt[key], texts...)
+		}
+	}
+}
+
+// WithMX sets the MX records of the resolver, like map[name][]*net.MX.
+func WithMX(records map[string][]*net.MX) ResolverOption {
+	return func(r *resolver) {
+		r.mx = make(map[string][]*net.MX, len(records))
+		for name, mxs := range records {
+			key := normalizeHostLoosely(name)
+			for _, mx := range mxs {
+				r.mx[key] = append(r.mx[key], &net.MX{Host: absDomainName(mx.Host), Pref: mx.Pref})
+			}
+		}
+	}
+}
+
+// WithNS sets the NS records of the resolver, like map[name][]*net.NS.
+func WithNS(records map[string][]*net.NS) ResolverOption {
+	return func(r *resolver) {
+		r.ns = make(map[string][]*net.NS, len(records))
+		for name, nss := range records {
+			key := normalizeHostLoosely(name)
+			for _, ns := range nss {
+				r.ns[key] = append(r.ns[key], &net.NS{Host: absDomainName(ns.Host)})
+			}
+		}
+	}
+}
+
+// LookupTXT returns the records set with WithTXT for name. The names
+// of the mapping without such records have none, the other names are
+// looked up with the fallback resolver.
+func (r *resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	key, err := recordsKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := r.txt[key]; ok {
+		return append([]string(nil), records...), nil
+	}
+	if r.has(key) {
+		return nil, noRecordsError(name)
+	}
+	if r.fallback == nil {
+		return systemResolver().LookupTXT(ctx, name)
+	}
+	if fallback, ok := r.fallback.(TXTResolver); ok {
+		return fallback.LookupTXT(ctx, name)
+	}
+	return nil, unsupportedLookupError("TXT", name)
+}
+
+// LookupMX returns the records set with WithMX for name. The names of
+// the mapping without such records have none, the other names are
+// looked up with the fallback resolver.
+func (r *resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	key, err := recordsKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := r.mx[key]; ok {
+		mxs := make([]*net.MX, len(records))
+		for i, mx := range records {
+			copied := *mx
+			mxs[i] = &copied
+		}
+		return mxs, nil
+	}
+	if r.has(key) {
+		return nil, noRecordsError(name)
+	}
+	if r.fallback == nil {
+		return systemResolver().LookupMX(ctx, name)
+	}
+	if fallback, ok := r.fallback.(MXResolver); ok {
+		return fallback.LookupMX(ctx, name)
+	}
+	return nil, unsupportedLookupError("MX", name)
+}
+
+// LookupNS returns the records set with WithNS for name. The names of
+// the mapping without such records have none, the other names are
+// looked up with the fallback resolver.
+func (r *resolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	key, err := recordsKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if records, ok := r.ns[key]; ok {
+		nss := make([]*net.NS, len(records))
+		for i, ns := range records {
+			copied := *ns
+			nss[i] = &copied
+		}
+		return nss, nil
+	}
+	if r.has(key) {
+		return nil, noRecordsError(name)
+	}
+	if r.fallback == nil {
+		return systemResolver().LookupNS(ctx, name)
+	}
+	if fallback, ok := r.fallback.(NSResolver); ok {
+		return fallback.LookupNS(ctx, name)
+	}
+	return nil, unsupportedLookupError("NS", name)
+}
+
+// LookupCNAME returns the canonical name of host, following the aliases
+// of the mapping: a host mapped to a single host name is an alias of
+// it. The hosts that are not in the mapping are looked up with the
+// fallback resolver.
+func (r *resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	name, err := recordsKey(host)
+	if err != nil {
+		return "", err
+	}
+	if !r.has(name) {
+		if r.fallback == nil {
+			return systemResolver().LookupCNAME(ctx, name)
+		}
+		if fallback, ok := r.fallback.(CNAMEResolver); ok {
+			return fallback.LookupCNAME(ctx, name)
+		}
+		return "", unsupportedLookupError("CNAME", host)
+	}
+	var seen []string
+	for {
+		records := r.hosts[name]
+		if len(records) == 0 && len(r.sinkhole) == 0 {
+			return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		if len(records) != 1 || isIPLiteral(records[0]) {
+			return absDomainName(name), nil
+		}
+		target := records[0]
+		if target == name || contains(seen, target) {
+			return "", &net.DNSError{Err: "alias loop through " + target, Name: host}
+		}
+		if len(seen) >= maxAliasDepth {
+			return "", &net.DNSError{Err: "too many aliases", Name: host}
+		}
+		seen = append(seen, name)
+		if !r.has(target) {
+			if r.fallback == nil {
+				return systemResolver().LookupCNAME(ctx, target)
+			}
+			if fallback, ok := r.fallback.(CNAMEResolver); ok {
+				return fallback.LookupCNAME(ctx, target)
+			}
+			return absDomainName(target), nil
+		}
+		name = target
+	}
+}
+
+// recordsKey returns the normalized form of name, as used in the
+// mappings.
+func recordsKey(name string) (string, error) {
+	key, err := normalizeHost(name)
+	if err != nil {
+		return "", invalidHostError(name, err)
+	}
+	return key, nil
+}
+
+// noRecordsError returns the error for a name that exists but has no
+// records of the type looked up.
+func noRecordsError(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// unsupportedLookupError returns the error for a lookup of a record
+// type that a resolver cannot look up.
+func unsupportedLookupError(recordType, name string) error {
+	return &net.DNSError{Err: "resolver does not support " + recordType + " lookups", Name: name}
+}
@@ -0,0 +1,80 @@
+package ara_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestRecords(t *testing.T) {
+	custom := ara.NewCustomResolver(
+		map[string][]string{
+			"example.com":      {"127.0.0.1"},
+			"www.example.com":  {"web.example.com"},
+			"web.example.com":  {"example.com"},
+			"loop.example.com": {"loop.example.com"},
+		},
+		ara.WithTXT(map[string][]string{"Example.com": {"v=spf1 -all"}}),
+		ara.WithMX(map[string][]*net.MX{"example.com": {{Host: "mail.example.com", Pref: 10}}}),
+		ara.WithNS(map[string][]*net.NS{"example.com": {{Host: "ns1.example.com."}}}),
+	)
+	// Pass the lookups through a split resolver too.
+	for _, resolver := range []ara.Resolver{custom, ara.NewSplitResolver([]ara.SplitRule{{Suffix: "example.com", Resolver: custom}}, nil)} {
+		ctx := context.Background()
+		texts, err := resolver.(ara.TXTResolver).LookupTXT(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(texts, []string{"v=spf1 -all"}) {
+			t.Errorf("wrong TXT records %v", texts)
+		}
+		mxs, err := resolver.(ara.MXResolver).LookupMX(ctx, "EXAMPLE.com.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mxs) != 1 || *mxs[0] != (net.MX{Host: "mail.example.com.", Pref: 10}) {
+			t.Errorf("wrong MX records %v", mxs)
+		}
+		nss, err := resolver.(ara.NSResolver).LookupNS(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nss) != 1 || nss[0].Host != "ns1.example.com." {
+			t.Errorf("wrong NS records %v", nss)
+		}
+		_, err = resolver.(ara.MXResolver).LookupMX(ctx, "www.example.com")
+		if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+			t.Errorf("expected a not found error for a host without MX records, got %v", err)
+		}
+		cname, err := resolver.(ara.CNAMEResolver).LookupCNAME(ctx, "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cname != "example.com." {
+			t.Errorf("wrong canonical name %s", cname)
+		}
+		_, err = resolver.(ara.CNAMEResolver).LookupCNAME(ctx, "loop.example.com")
+		if _, ok := err.(*net.DNSError); !ok {
+			t.Errorf("expected a DNS error for an alias loop, got %v", err)
+		}
+	}
+
+	resolver := ara.NetResolver(custom.(ara.ReverseResolver))
+	texts, err := resolver.LookupTXT(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(texts, []string{"v=spf1 -all"}) {
+		t.Errorf("wrong TXT records over DNS %v", texts)
+	}
+	mxs, err := resolver.LookupMX(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mxs) != 1 || mxs[0].Host != "mail.example.com." {
+		t.Errorf("wrong MX records over DNS %v", mxs)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net"
 	"net/http/httptrace"
+	"sort"
+	"strings"
 )
 
 // A Resolver looks up hosts.
@@ -11,8 +13,41 @@ type Resolver interface {
 	LookupHost(ctx context.Context, host string) ([]string, error)
 }
 
+// A ReverseResolver is a Resolver that can also look up the names of
+// addresses.
+//
+// See net.Resolver.LookupAddr for a description of the parameters.
+type ReverseResolver interface {
+	Resolver
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
 type resolver struct {
 	hosts map[string][]string
+
+	// fallback is used for the hosts that are not in hosts.
+	// If nil, net.DefaultResolver is used.
+	fallback Resolver
+
+	// sinkhole is returned for the blocked hosts. If empty, they
+	// are not found.
+	sinkhole []string
+
+	// txt, mx and ns hold the records set with the options.
+	txt map[string][]string
+	mx  map[string][]*net.MX
+	ns  map[string][]*net.NS
+}
+
+// A ResolverOption configures the resolver returned by NewCustomResolver.
+type ResolverOption func(r *resolver)
+
+// WithSinkhole makes the blocked hosts resolve to the given addresses,
+// like 0.0.0.0, instead of not being found.
+func WithSinkhole(addrs ...string) ResolverOption {
+	return func(r *resolver) {
+		r.sinkhole = addrs
+	}
 }
 
 // NewCustomResolver returns a resolver that will give priority
@@ -21,14 +56,39 @@ type resolver struct {
 // If a host is not part of the given mapping, it will use the
 // net.DefaultResolver.
 //
+// Host names are compared in their canonical form, in the mapping
+// and on lookups alike: lowercase, without a trailing dot and with
+// internationalized names converted to punycode. Lookups of invalid
+// host names fail with a *net.DNSError.
+//
+// The mapping is not validated; use ParseHosts to find the mistakes in
+// it up front.
+//
+// The mapping is copied, so changing hosts afterwards has no effect on
+// the returned resolver.
+//
 // hosts is a map of addresses for a host name, like map[host][]address.
-func NewCustomResolver(hosts map[string][]string) Resolver {
-	return &resolver{
-		hosts: hosts,
+// An address can also be another host name, in which case it is
+// resolved in turn, through the mapping first, like a CNAME record.
+//
+// A host mapped to no addresses, like map[host][]string{}, is blocked:
+// looking it up fails with a not found *net.DNSError, or gives the
+// addresses set with WithSinkhole, without reaching net.DefaultResolver.
+//
+// The returned resolver is also a ReverseResolver, a CNAMEResolver, a
+// TXTResolver, an MXResolver and an NSResolver. The records of the
+// last three are set with WithTXT, WithMX and WithNS.
+func NewCustomResolver(hosts map[string][]string, opts ...ResolverOption) Resolver {
+	r := &resolver{
+		hosts: normalizeHosts(hosts),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-func handleClientTrace(t *httptrace.ClientTrace, host string, records []string) {
+func handleClientTrace(t *httptrace.ClientTrace, host string, records []string, err error) {
 	if t.DNSStart != nil {
 		t.DNSStart(httptrace.DNSStartInfo{
 			Host: host,
@@ -46,19 +106,158 @@ func handleClientTrace(t *httptrace.ClientTrace, host string, records []string)
 		}
 		t.DNSDone(httptrace.DNSDoneInfo{
 			Addrs: addrs,
+			Err:   err,
 		})
 	}
 }
 
 func (r *resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
-	records := r.hosts[host]
-	if records != nil && len(records) != 0 {
+	name, err := normalizeHost(host)
+	if err != nil {
+		return nil, invalidHostError(host, err)
+	}
+	records, ok := r.hosts[name]
+	if ok {
+		addrs, err := r.resolveAliases(ctx, name, records, nil)
 		t := httptrace.ContextClientTrace(ctx)
 		if t != nil {
-			handleClientTrace(t, host, records)
+			handleClientTrace(t, host, addrs, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return addrs, nil
+	}
+	return r.lookupFallback(ctx, name)
+}
+
+func (r *resolver) lookupFallback(ctx context.Context, host string) ([]string, error) {
+	if r.fallback != nil {
+		return r.fallback.LookupHost(ctx, host)
+	}
+	return systemResolver().LookupHost(ctx, host)
+}
+
+// LookupAddr returns the hosts of the mapping that have addr among their
+// addresses, with a trailing dot as in PTR records. The hosts that are
+// mapped to addr only through another host are left out, as the PTR
+// record of an address names its canonical host. If no host of the
+// mapping has addr, the fallback resolver is used.
+func (r *resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	ip, zone := splitZone(addr)
+	if ip == nil {
+		return nil, &net.DNSError{Err: "unrecognized address", Name: addr}
+	}
+	var names []string
+	for host, records := range r.hosts {
+		for _, record := range records {
+			if recordIP, recordZone := splitZone(record); recordIP.Equal(ip) && recordZone == zone {
+				names = append(names, host+".")
+				break
+			}
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names, nil
+	}
+	if r.fallback == nil {
+		return systemResolver().LookupAddr(ctx, addr)
+	}
+	if fallback, ok := r.fallback.(ReverseResolver); ok {
+		return fallback.LookupAddr(ctx, addr)
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+// splitZone parses s as an IP address with an optional IPv6 zone. The
+// returned IP is nil if s is not an IP address.
+func splitZone(s string) (net.IP, string) {
+	var zone string
+	if i := strings.LastIndexByte(s, '%'); i >= 0 && strings.IndexByte(s, ':') >= 0 {
+		s, zone = s[:i], s[i+1:]
+	}
+	return net.ParseIP(s), zone
+}
+
+// maxAliasDepth is the maximum number of aliases followed for a host.
+const maxAliasDepth = 8
+
+// resolveAliases replaces the host names among the records of host
+// with their own addresses, following the mapping first and the
+// fallback resolver after. seen holds the hosts whose records led to
+// host.
+func (r *resolver) resolveAliases(ctx context.Context, host string, records []string, seen []string) ([]string, error) {
+	if len(records) == 0 {
+		if len(r.sinkhole) > 0 {
+			return r.sinkhole, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []string
+	var firstErr error
+	for _, record := range records {
+		if isIPLiteral(record) {
+			addrs = appendUnique(addrs, record)
+			continue
+		}
+		var resolved []string
+		var err error
+		switch {
+		case record == host || contains(seen, record):
+			err = &net.DNSError{Err: "alias loop through " + record, Name: host}
+		case len(seen) >= maxAliasDepth:
+			err = &net.DNSError{Err: "too many aliases", Name: host}
+		case r.has(record):
+			resolved, err = r.resolveAliases(ctx, record, r.hosts[record], append(seen, host))
+		default:
+			resolved, err = r.lookupFallback(ctx, record)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
 		}
+		for _, addr := range resolved {
+			addrs = appendUnique(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return addrs, nil
+}
+
+func (r *resolver) has(host string) bool {
+	_, ok := r.hosts[host]
+	return ok
+}
+
+func (r *resolver) maps(name string) bool {
+	return r.has(name) || overrides(r.fallback, name)
+}
+
+// isIPLiteral reports whether s is an IP address, with an optional
+// IPv6 zone.
+func isIPLiteral(s string) bool {
+	ip, _ := splitZone(s)
+	return ip != nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
 
-		return records, nil
+func appendUnique(list []string, s string) []string {
+	if contains(list, s) {
+		return list
 	}
-	return net.DefaultResolver.LookupHost(ctx, host)
+	return append(list, s)
 }
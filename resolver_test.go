@@ -2,7 +2,9 @@ package ara_test
 
 import (
 	"context"
+	"net"
 	"net/http/httptrace"
+	"reflect"
 	"testing"
 
 	"github.com/cevatbarisyilmaz/ara"
@@ -22,7 +24,7 @@ func TestNewCustomResolver(t *testing.T) {
 	} else if addrs[0] != "127.0.0.1" {
 		t.Error("wrong address")
 	}
-	addrs, err = resolver.LookupHost(context.Background(), "google.com")
+	addrs, err = resolver.LookupHost(context.Background(), "localhost")
 	if err != nil {
 		t.Error(err)
 	} else if addrs == nil {
@@ -30,6 +32,17 @@ func TestNewCustomResolver(t *testing.T) {
 	} else if len(addrs) == 0 {
 		t.Error("no addresses")
 	}
+
+	// The mapping is copied.
+	hosts := map[string][]string{"example.com": {"127.0.0.1"}}
+	resolver = ara.NewCustomResolver(hosts)
+	hosts["example.com"] = []string{"127.0.0.2"}
+	addrs, err = resolver.LookupHost(context.Background(), "example.com")
+	if err != nil {
+		t.Error(err)
+	} else if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("wrong addresses %v after changing the mapping", addrs)
+	}
 }
 
 func TestClientTrace(t *testing.T) {
@@ -64,3 +77,100 @@ func TestClientTrace(t *testing.T) {
 		t.Error("ClientTrace.DNSDone not called")
 	}
 }
+
+func TestAliases(t *testing.T) {
+	resolver := ara.NewCustomResolver(map[string][]string{
+		"api.example.com":   {"api-blue.internal", "10.0.0.1"},
+		"api-blue.internal": {"10.0.0.1", "10.0.0.2"},
+		"loop.example.com":  {"loop.internal"},
+		"loop.internal":     {"loop.example.com"},
+	})
+	addrs, err := resolver.LookupHost(context.Background(), "api.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || addrs[0] != "10.0.0.1" || addrs[1] != "10.0.0.2" {
+		t.Errorf("wrong addresses %v", addrs)
+	}
+	_, err = resolver.LookupHost(context.Background(), "loop.example.com")
+	if _, ok := err.(*net.DNSError); !ok {
+		t.Errorf("expected a DNS error for the loop, got %v", err)
+	}
+}
+
+func TestNameNormalization(t *testing.T) {
+	resolver := ara.NewCustomResolver(map[string][]string{
+		"example.com":  {"127.0.0.1"},
+		"Bücher.DE.":   {"127.0.0.2"},
+		"_svc.example": {"127.0.0.3"},
+	})
+	for host, expected := range map[string]string{
+		"example.com":      "127.0.0.1",
+		"Example.COM":      "127.0.0.1",
+		"example.com.":     "127.0.0.1",
+		"bücher.de":        "127.0.0.2",
+		"xn--bcher-kva.de": "127.0.0.2",
+		"_SVC.example":     "127.0.0.3",
+	} {
+		addrs, err := resolver.LookupHost(context.Background(), host)
+		if err != nil {
+			t.Errorf("lookup of %s failed: %v", host, err)
+		} else if len(addrs) != 1 || addrs[0] != expected {
+			t.Errorf("wrong addresses %v for %s", addrs, host)
+		}
+	}
+	for _, host := range []string{"exa mple.com", "a..b", "-bad.example.com"} {
+		_, err := resolver.LookupHost(context.Background(), host)
+		if _, ok := err.(*net.DNSError); !ok {
+			t.Errorf("expected a DNS error for %q, got %v", host, err)
+		}
+	}
+}
+
+func TestBlockedHosts(t *testing.T) {
+	hosts := map[string][]string{
+		"telemetry.example.com": {},
+		"analytics.example.com": nil,
+		"cdn.example.com":       {"telemetry.example.com"},
+	}
+	resolver := ara.NewCustomResolver(hosts)
+	for host := range hosts {
+		_, err := resolver.LookupHost(context.Background(), host)
+		if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+			t.Errorf("expected a not found error for %s, got %v", host, err)
+		}
+	}
+	resolver = ara.NewCustomResolver(hosts, ara.WithSinkhole("0.0.0.0"))
+	for host := range hosts {
+		addrs, err := resolver.LookupHost(context.Background(), host)
+		if err != nil {
+			t.Errorf("lookup of %s failed: %v", host, err)
+		} else if len(addrs) != 1 || addrs[0] != "0.0.0.0" {
+			t.Errorf("wrong addresses %v for %s", addrs, host)
+		}
+	}
+}
+
+func TestReverseLookup(t *testing.T) {
+	resolver := ara.NewCustomResolver(map[string][]string{
+		"example.com":     {"127.0.0.1", "::1"},
+		"api.example.com": {"127.0.0.1"},
+		"www.example.com": {"example.com"},
+	}).(ara.ReverseResolver)
+	for addr, expected := range map[string][]string{
+		"127.0.0.1":        {"api.example.com.", "example.com."},
+		"0:0:0:0:0:0:0:1":  {"example.com."},
+		"::ffff:127.0.0.1": {"api.example.com.", "example.com."},
+	} {
+		names, err := resolver.LookupAddr(context.Background(), addr)
+		if err != nil {
+			t.Errorf("reverse lookup of %s failed: %v", addr, err)
+		} else if !reflect.DeepEqual(names, expected) {
+			t.Errorf("wrong names %v for %s", names, addr)
+		}
+	}
+	_, err := resolver.LookupAddr(context.Background(), "not an address")
+	if _, ok := err.(*net.DNSError); !ok {
+		t.Errorf("expected a DNS error, got %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package ara
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+)
+
+// An AddressSelector decides the order in which the resolved addresses
+// of a host are dialed. The first address is the one tried first.
+type AddressSelector interface {
+	// Select returns the given addresses, which are in host:port
+	// form, in the order they should be dialed. host is the host
+	// name that was resolved.
+	Select(ctx context.Context, host string, addresses []string) []string
+}
+
+// connTracker is implemented by the selectors that need to know how
+// many connections are open to each address.
+type connTracker interface {
+	track(address string) (release func())
+}
+
+// trackedConn calls release once when it is closed.
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// RoundRobinSelector rotates the addresses of each host by one on
+// every dial.
+//
+// The zero value is ready to use.
+type RoundRobinSelector struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+// Select implements AddressSelector.
+func (s *RoundRobinSelector) Select(ctx context.Context, host string, addresses []string) []string {
+	if len(addresses) < 2 {
+		return addresses
+	}
+	s.mu.Lock()
+	if s.next == nil {
+		s.next = make(map[string]int)
+	}
+	i := s.next[host] % len(addresses)
+	s.next[host] = i + 1
+	s.mu.Unlock()
+	return append(append(make([]string, 0, len(addresses)), addresses[i:]...), addresses[:i]...)
+}
+
+// RandomSelector shuffles the addresses on every dial.
+//
+// The zero value is ready to use.
+type RandomSelector struct{}
+
+// Select implements AddressSelector.
+func (RandomSelector) Select(ctx context.Context, host string, addresses []string) []string {
+	shuffled := make([]string, len(addresses))
+	copy(shuffled, addresses)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
+
+// A WeightResolver is a Resolver that can also tell the relative
+// weights of the addresses it returns for a host.
+type WeightResolver interface {
+	Resolver
+
+	// LookupWeights returns the weights of the host's addresses,
+	// keyed by address. Addresses without a weight are treated as
+	// having a weight of 1.
+	LookupWeights(ctx context.Context, host string) (map[string]int, error)
+}
+
+// WeightedSelector orders the addresses randomly, giving each address
+// a chance to come first in proportion to its weight.
+type WeightedSelector struct {
+	// Resolver supplies the weights. It is usually the same
+	// resolver the Dialer uses.
+	//
+	// If nil, the addresses are left in their order.
+	Resolver WeightResolver
+}
+
+// Select implements AddressSelector.
+func (s *WeightedSelector) Select(ctx context.Context, host string, addresses []string) []string {
+	if s.Resolver == nil {
+		return addresses
+	}
+	weights, err := s.Resolver.LookupWeights(ctx, host)
+	if err != nil || len(weights) == 0 {
+		return addresses
+	}
+	remaining := make([]string, len(addresses))
+	copy(remaining, addresses)
+	ordered := make([]string, 0, len(addresses))
+	for len(remaining) > 0 {
+		total := 0
+		for _, addr := range remaining {
+			total += weight(weights, addr)
+		}
+		i := 0
+		if total > 0 {
+			n := rand.Intn(total)
+			for ; i < len(remaining)-1; i++ {
+				n -= weight(weights, remaining[i])
+				if n < 0 {
+					break
+				}
+			}
+		}
+		ordered = append(ordered, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return ordered
+}
+
+// weight returns the weight of the host:port address.
+func weight(weights map[string]int, address string) int {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	w, ok := weights[host]
+	if !ok {
+		return 1
+	}
+	if w < 0 {
+		return 0
+	}
+	return w
+}
+
+type weightedResolver struct {
+	hosts map[string]map[string]int
+}
+
+// NewWeightedResolver returns a resolver that maps hosts to weighted
+// addresses, like map[host]map[address]weight, to be used with a
+// WeightedSelector.
+//
+// Addresses are returned in the order of decreasing weight. If a host
+// is not part of the given mapping, it will use the
+// net.DefaultResolver and all of its addresses will have equal weights.
+//
+// Host names are compared in their canonical form, as in
+// NewCustomResolver. The mapping is copied, so changing hosts
+// afterwards has no effect on the returned resolver.
+func NewWeightedResolver(hosts map[string]map[string]int) WeightResolver {
+	normalized := make(map[string]map[string]int, len(hosts))
+	for host, weights := range hosts {
+		key := normalizeHostLoosely(host)
+		if normalized[key] == nil {
+			normalized[key] = make(map[string]int, len(weights))
+		}
+		for addr, weight := range weights {
+			normalized[key][addr] = weight
+		}
+	}
+	return &weightedResolver{
+		hosts: normalized,
+	}
+}
+
+func (r *weightedResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	key, err := recordsKey(host)
+	if err != nil {
+		return nil, err
+	}
+	weights := r.hosts[key]
+	if len(weights) == 0 {
+		return systemResolver().LookupHost(ctx, host)
+	}
+	records := make([]string, 0, len(weights))
+	for addr := range weights {
+		records = append(records, addr)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if weights[records[i]] != weights[records[j]] {
+			return weights[records[i]] > weights[records[j]]
+		}
+		return records[i] < records[j]
+	})
+	return records, nil
+}
+
+func (r *weightedResolver) maps(name string) bool {
+	return len(r.hosts[name]) > 0
+}
+
+func (r *weightedResolver) LookupWeights(ctx context.Context, host string) (map[string]int, error) {
+	key, err := recordsKey(host)
+	if err != nil {
+		return nil, err
+	}
+	return r.hosts[key], nil
+}
+
+// activeConns counts the open connections per address.
+type activeConns struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (a *activeConns) track(address string) func() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.counts == nil {
+		a.counts = make(map[string]int)
+	}
+	a.counts[address]++
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.counts[address]--
+		if a.counts[address] <= 0 {
+			delete(a.counts, address)
+		}
+	}
+}
+
+// snapshot returns the current counts of the given addresses.
+func (a *activeConns) snapshot(addresses []string) []int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	counts := make([]int, len(addresses))
+	for i, addr := range addresses {
+		counts[i] = a.counts[addr]
+	}
+	return counts
+}
+
+// LeastConnSelector orders the addresses by their number of active
+// connections opened through it, fewest first.
+//
+// Connections are counted by wrapping the ones returned from the
+// Dialer, so they must be closed for the counts to go down.
+//
+// The zero value is ready to use.
+type LeastConnSelector struct {
+	conns activeConns
+}
+
+// Select implements AddressSelector.
+func (s *LeastConnSelector) Select(ctx context.Context, host string, addresses []string) []string {
+	counts := s.conns.snapshot(addresses)
+	indexes := make([]int, len(addresses))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return counts[indexes[i]] < counts[indexes[j]]
+	})
+	ordered := make([]string, len(addresses))
+	for i, index := range indexes {
+		ordered[i] = addresses[index]
+	}
+	return ordered
+}
+
+func (s *LeastConnSelector) track(address string) func() {
+	return s.conns.track(address)
+}
+
+// PowerOfTwoSelector picks two addresses at random and puts the one
+// with fewer active connections first, followed by the other one and
+// the rest of the addresses in their original order.
+//
+// Connections are counted by wrapping the ones returned from the
+// Dialer, so they must be closed for the counts to go down.
+//
+// The zero value is ready to use.
+type PowerOfTwoSelector struct {
+	conns activeConns
+}
+
+// Select implements AddressSelector.
+func (s *PowerOfTwoSelector) Select(ctx context.Context, host string, addresses []string) []string {
+	if len(addresses) < 2 {
+		return addresses
+	}
+	i := rand.Intn(len(addresses))
+	j := rand.Intn(len(addresses) - 1)
+	if j >= i {
+		j++
+	}
+	counts := s.conns.snapshot([]string{addresses[i], addresses[j]})
+	if counts[1] < counts[0] {
+		i, j = j, i
+	}
+	ordered := make([]string, 0, len(addresses))
+	ordered = append(ordered, addresses[i], addresses[j])
+	for k, addr := range addresses {
+		if k != i && k != j {
+			ordered = append(ordered, addr)
+		}
+	}
+	return ordered
+}
+
+func (s *PowerOfTwoSelector) track(address string) func() {
+	return s.conns.track(address)
+}
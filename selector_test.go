@@ -0,0 +1,91 @@
+package ara_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestRoundRobinSelector(t *testing.T) {
+	addresses := []string{"127.0.0.1:80", "127.0.0.2:80", "127.0.0.3:80"}
+	selector := &ara.RoundRobinSelector{}
+	for i := 0; i < 6; i++ {
+		ordered := selector.Select(context.Background(), "example.com", addresses)
+		if len(ordered) != len(addresses) {
+			t.Fatal("wrong number of addresses")
+		}
+		if ordered[0] != addresses[i%len(addresses)] {
+			t.Errorf("wrong first address %s on round %d", ordered[0], i)
+		}
+	}
+}
+
+func TestWeightedSelector(t *testing.T) {
+	resolver := ara.NewWeightedResolver(map[string]map[string]int{"Example.com.": {"127.0.0.1": 0, "127.0.0.2": 5}})
+	records, err := resolver.LookupHost(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0] != "127.0.0.2" {
+		t.Fatalf("wrong records %v", records)
+	}
+	selector := &ara.WeightedSelector{Resolver: resolver}
+	addresses := []string{"127.0.0.1:80", "127.0.0.2:80"}
+	for i := 0; i < 20; i++ {
+		ordered := selector.Select(context.Background(), "EXAMPLE.com", addresses)
+		if ordered[0] != "127.0.0.2:80" {
+			t.Fatal("address with zero weight came first")
+		}
+	}
+
+	// Without a Resolver, the addresses are left in their order.
+	ordered := (&ara.WeightedSelector{}).Select(context.Background(), "example.com", addresses)
+	if len(ordered) != 2 || ordered[0] != addresses[0] || ordered[1] != addresses[1] {
+		t.Errorf("wrong order %v without a resolver", ordered)
+	}
+}
+
+func TestLeastConnSelector(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	_, port, err := net.SplitHostPort(first.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer second.Close()
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1", "127.0.0.2"}}),
+		Selector: &ara.LeastConnSelector{},
+	}
+	dial := func() net.Conn {
+		conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	a, b := dial(), dial()
+	defer b.Close()
+	if a.RemoteAddr().String() == b.RemoteAddr().String() {
+		t.Fatal("both connections went to the same address")
+	}
+	remote := a.RemoteAddr().String()
+	err = a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dial()
+	defer c.Close()
+	if c.RemoteAddr().String() != remote {
+		t.Error("connection did not go to the least loaded address")
+	}
+}
@@ -0,0 +1,192 @@
+package ara
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5NoAuth       = 0x00
+	socks5PasswordAuth = 0x02
+	socks5NoAcceptable = 0xff
+
+	socks5Connect = 0x01
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+)
+
+var socks5Replies = []string{
+	"succeeded",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// SOCKS5Proxy is a Proxy that connects through a SOCKS5 server, as
+// described in RFC 1928.
+type SOCKS5Proxy struct {
+	// Addr is the address of the SOCKS5 server in host:port form.
+	Addr string
+
+	// Username and Password are used to authenticate to the server
+	// as described in RFC 1929. If Username is empty, no
+	// authentication is offered.
+	Username string
+	Password string
+}
+
+// Server implements Proxy.
+func (p *SOCKS5Proxy) Server() string {
+	return p.Addr
+}
+
+// Connect implements Proxy.
+func (p *SOCKS5Proxy) Connect(ctx context.Context, conn net.Conn, network, target string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("socks5: network not supported: " + network)
+	}
+	err := handshake(ctx, conn, func() error {
+		return p.connect(conn, target)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *SOCKS5Proxy) connect(conn net.Conn, target string) error {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return errors.New("socks5: invalid port " + portStr)
+	}
+
+	methods := []byte{socks5NoAuth}
+	if p.Username != "" {
+		methods = append(methods, socks5PasswordAuth)
+	}
+	_, err = conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected protocol version %d", reply[0])
+	}
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5PasswordAuth:
+		if p.Username == "" {
+			return errors.New("socks5: server requires authentication")
+		}
+		err = p.authenticate(conn)
+		if err != nil {
+			return err
+		}
+	case socks5NoAcceptable:
+		return errors.New("socks5: no acceptable authentication methods")
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method %d", reply[1])
+	}
+
+	request := []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(request, socks5IPv4)
+			request = append(request, ip4...)
+		} else {
+			request = append(request, socks5IPv6)
+			request = append(request, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("socks5: host name too long")
+		}
+		request = append(request, socks5Domain, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	_, err = conn.Write(request)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected protocol version %d", header[0])
+	}
+	if header[1] != 0 {
+		if int(header[1]) < len(socks5Replies) {
+			return errors.New("socks5: " + socks5Replies[header[1]])
+		}
+		return fmt.Errorf("socks5: unknown reply %d", header[1])
+	}
+	// Skip the bound address, it is of no use to the caller.
+	var skip int
+	switch header[3] {
+	case socks5IPv4:
+		skip = net.IPv4len
+	case socks5IPv6:
+		skip = net.IPv6len
+	case socks5Domain:
+		length := make([]byte, 1)
+		_, err = io.ReadFull(conn, length)
+		if err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+func (p *SOCKS5Proxy) authenticate(conn net.Conn) error {
+	if len(p.Username) > 255 || len(p.Password) > 255 {
+		return errors.New("socks5: username or password too long")
+	}
+	request := []byte{0x01, byte(len(p.Username))}
+	request = append(request, p.Username...)
+	request = append(request, byte(len(p.Password)))
+	request = append(request, p.Password...)
+	_, err := conn.Write(request)
+	if err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("socks5: authentication failed")
+	}
+	return nil
+}
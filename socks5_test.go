@@ -0,0 +1,157 @@
+package ara_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+// serveSOCKS5 runs a minimal SOCKS5 server that requires password
+// authentication and sends every requested target over targets.
+func serveSOCKS5(listener net.Listener, backend string, targets chan<- string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 512)
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+				return
+			}
+			if _, err := conn.Write([]byte{5, 2}); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			user := make([]byte, buf[1])
+			if _, err := io.ReadFull(conn, user); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+				return
+			}
+			pass := make([]byte, buf[0])
+			if _, err := io.ReadFull(conn, pass); err != nil {
+				return
+			}
+			if string(user) != "user" || string(pass) != "pass" {
+				_, _ = conn.Write([]byte{1, 1})
+				return
+			}
+			if _, err := conn.Write([]byte{1, 0}); err != nil {
+				return
+			}
+			if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+				return
+			}
+			var host string
+			switch buf[3] {
+			case 1:
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				host = net.IP(buf[:4]).String()
+			case 3:
+				if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+					return
+				}
+				name := make([]byte, buf[0])
+				if _, err := io.ReadFull(conn, name); err != nil {
+					return
+				}
+				host = string(name)
+			default:
+				return
+			}
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			port := int(buf[0])<<8 | int(buf[1])
+			targets <- net.JoinHostPort(host, strconv.Itoa(port))
+			target, err := net.Dial("tcp", backend)
+			if err != nil {
+				_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer target.Close()
+			if _, err := conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0}); err != nil {
+				return
+			}
+			_, _ = io.Copy(conn, target)
+		}()
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("Alo?"))
+			_ = conn.Close()
+		}
+	}()
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	targets := make(chan string, 1)
+	go serveSOCKS5(proxy, backend.Addr().String(), targets)
+	_, proxyPort, err := net.SplitHostPort(proxy.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{
+			"proxy.example.com": {"127.0.0.1"},
+			"example.com":       {"127.0.0.2"},
+		}),
+		Proxy: &ara.SOCKS5Proxy{Addr: "proxy.example.com:" + proxyPort, Username: "user", Password: "pass"},
+	}
+	for _, remote := range []bool{false, true} {
+		dialer.RemoteResolve = remote
+		conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+		if string(body) != "Alo?" {
+			t.Errorf("wrong message %q", body)
+		}
+		expected := "127.0.0.2:80"
+		if remote {
+			expected = "example.com:80"
+		}
+		if target := <-targets; target != expected {
+			t.Errorf("expected the proxy to be asked for %s, got %s", expected, target)
+		}
+	}
+	dialer.Proxy = &ara.SOCKS5Proxy{Addr: "proxy.example.com:" + proxyPort, Username: "user", Password: "wrong"}
+	_, err = dialer.DialContext(context.Background(), "tcp", "example.com:80")
+	if err == nil {
+		t.Error("dial succeeded with wrong credentials")
+	}
+}
@@ -0,0 +1,153 @@
+package ara
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SplitRule routes the lookups of the hosts in a domain to a resolver.
+type SplitRule struct {
+	// Suffix is the domain, like "corp.internal". It matches the
+	// domain itself and all of its subdomains. A leading dot is
+	// ignored.
+	Suffix string
+
+	// Resolver is used for the matching hosts.
+	Resolver Resolver
+
+	// Timeout optionally limits the duration of the lookups made
+	// through this rule.
+	Timeout time.Duration
+}
+
+type splitResolver struct {
+	rules []SplitRule
+
+	// def is used for the hosts that no rule matches.
+	// If nil, net.DefaultResolver is used.
+	def Resolver
+}
+
+// NewSplitResolver returns a resolver that sends each lookup to the
+// resolver of the rule whose suffix matches the host, like a
+// split-horizon DNS setup. When multiple rules match, the one with the
+// longest suffix wins. The hosts no rule matches are looked up with
+// def, or with net.DefaultResolver if def is nil.
+//
+// The returned resolver is also a TXTResolver, an MXResolver, a
+// CNAMEResolver and an NSResolver, passing these lookups to the
+// resolver chosen the same way when it supports them.
+func NewSplitResolver(rules []SplitRule, def Resolver) Resolver {
+	sorted := make([]SplitRule, len(rules))
+	for i, rule := range rules {
+		rule.Suffix = normalizeHostLoosely(strings.TrimPrefix(rule.Suffix, "."))
+		sorted[i] = rule
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Suffix) > len(sorted[j].Suffix)
+	})
+	return &splitResolver{
+		rules: sorted,
+		def:   def,
+	}
+}
+
+func (r *splitResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	resolver, ctx, cancel, err := r.resolverFor(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return resolver.LookupHost(ctx, host)
+}
+
+func (r *splitResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	resolver, ctx, cancel, err := r.resolverFor(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	if txt, ok := resolver.(TXTResolver); ok {
+		return txt.LookupTXT(ctx, name)
+	}
+	return nil, unsupportedLookupError("TXT", name)
+}
+
+func (r *splitResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	resolver, ctx, cancel, err := r.resolverFor(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	if mx, ok := resolver.(MXResolver); ok {
+		return mx.LookupMX(ctx, name)
+	}
+	return nil, unsupportedLookupError("MX", name)
+}
+
+func (r *splitResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	resolver, ctx, cancel, err := r.resolverFor(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+	if cname, ok := resolver.(CNAMEResolver); ok {
+		return cname.LookupCNAME(ctx, host)
+	}
+	return "", unsupportedLookupError("CNAME", host)
+}
+
+func (r *splitResolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	resolver, ctx, cancel, err := r.resolverFor(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	if ns, ok := resolver.(NSResolver); ok {
+		return ns.LookupNS(ctx, name)
+	}
+	return nil, unsupportedLookupError("NS", name)
+}
+
+func (r *splitResolver) maps(name string) bool {
+	if rule := r.match(name); rule != nil {
+		return overrides(rule.Resolver, name)
+	}
+	return overrides(r.def, name)
+}
+
+// resolverFor returns the resolver for the host name, with the context
+// to use it with, which must be canceled once the lookup is done.
+func (r *splitResolver) resolverFor(ctx context.Context, host string) (Resolver, context.Context, context.CancelFunc, error) {
+	name, err := normalizeHost(host)
+	if err != nil {
+		return nil, nil, nil, invalidHostError(host, err)
+	}
+	rule := r.match(name)
+	if rule == nil {
+		if r.def == nil {
+			return systemResolver(), ctx, func() {}, nil
+		}
+		return r.def, ctx, func() {}, nil
+	}
+	if rule.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, rule.Timeout)
+		return rule.Resolver, ctx, cancel, nil
+	}
+	return rule.Resolver, ctx, func() {}, nil
+}
+
+// match returns the rule with the longest suffix that matches the
+// normalized host name, or nil.
+func (r *splitResolver) match(name string) *SplitRule {
+	for i := range r.rules {
+		suffix := r.rules[i].Suffix
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return &r.rules[i]
+		}
+	}
+	return nil
+}
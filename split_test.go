@@ -0,0 +1,41 @@
+package ara_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+type slowResolver struct{}
+
+func (slowResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSplitResolver(t *testing.T) {
+	resolver := ara.NewSplitResolver([]ara.SplitRule{
+		{Suffix: "corp.internal", Resolver: ara.NewCustomResolver(map[string][]string{"db.corp.internal": {"10.0.0.1"}})},
+		{Suffix: ".eu.corp.internal", Resolver: ara.NewCustomResolver(map[string][]string{"db.eu.corp.internal": {"10.1.0.1"}})},
+		{Suffix: "svc.cluster.local", Resolver: slowResolver{}, Timeout: 10 * time.Millisecond},
+	}, ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}))
+	for host, expected := range map[string]string{
+		"db.corp.internal":    "10.0.0.1",
+		"DB.EU.corp.internal": "10.1.0.1",
+		"example.com":         "127.0.0.1",
+	} {
+		addrs, err := resolver.LookupHost(context.Background(), host)
+		if err != nil {
+			t.Errorf("lookup of %s failed: %v", host, err)
+		} else if len(addrs) != 1 || addrs[0] != expected {
+			t.Errorf("wrong addresses %v for %s", addrs, host)
+		}
+	}
+	_, err := resolver.LookupHost(context.Background(), "api.svc.cluster.local")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the rule timeout, got %v", err)
+	}
+}
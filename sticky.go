@@ -0,0 +1,97 @@
+package ara
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StickyCache remembers which resolved address of a host was last
+// dialed successfully, so that the next dial to the same host tries
+// that address first instead of going through the resolver order.
+//
+// A remembered address is forgotten when it expires or when the
+// resolver's answer for the host changes.
+//
+// A StickyCache is safe for concurrent use and can be shared between
+// multiple Dialers. The zero value is ready to use.
+type StickyCache struct {
+	// TTL is the length of time an address is remembered after its
+	// last successful dial.
+	//
+	// If zero, a default of 5 minutes is used.
+	TTL time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*stickyEntry
+}
+
+type stickyEntry struct {
+	address string
+	answer  string
+	expires time.Time
+}
+
+// Forget drops the remembered address of the given host, which is in
+// the host:port form passed to Dialer.DialContext.
+func (s *StickyCache) Forget(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.hosts, host)
+}
+
+// order moves the remembered address of the host to the front of the
+// list, if it is still valid.
+func (s *StickyCache) order(host string, addresses []string) []string {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.hosts[host]
+	if entry == nil {
+		return addresses
+	}
+	if now.After(entry.expires) || entry.answer != fingerprint(addresses) {
+		delete(s.hosts, host)
+		return addresses
+	}
+	for i, addr := range addresses {
+		if addr == entry.address {
+			ordered := make([]string, 0, len(addresses))
+			ordered = append(ordered, addr)
+			ordered = append(ordered, addresses[:i]...)
+			return append(ordered, addresses[i+1:]...)
+		}
+	}
+	return addresses
+}
+
+// remember records that address was dialed successfully for the host
+// while the resolver answered with addresses.
+func (s *StickyCache) remember(host string, addresses []string, address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hosts == nil {
+		s.hosts = make(map[string]*stickyEntry)
+	}
+	s.hosts[host] = &stickyEntry{
+		address: address,
+		answer:  fingerprint(addresses),
+		expires: time.Now().Add(s.ttl()),
+	}
+}
+
+func (s *StickyCache) ttl() time.Duration {
+	if s.TTL > 0 {
+		return s.TTL
+	}
+	return 5 * time.Minute
+}
+
+// fingerprint identifies a set of addresses regardless of their order.
+func fingerprint(addresses []string) string {
+	sorted := make([]string, len(addresses))
+	copy(sorted, addresses)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
@@ -0,0 +1,60 @@
+package ara_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestStickyCache(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attempts int32
+	dialer := ara.Dialer{
+		Resolver:    ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1", "127.0.0.2"}}),
+		StickyCache: &ara.StickyCache{},
+		Control: func(network, address string, c syscall.RawConn) error {
+			atomic.AddInt32(&attempts, 1)
+			return nil
+		},
+	}
+	for i := 0; i < 3; i++ {
+		conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+	}
+	if attempts != 4 {
+		t.Errorf("expected 4 dial attempts, got %d", attempts)
+	}
+	dialer.StickyCache.Forget("example.com:" + port)
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if attempts != 6 {
+		t.Errorf("expected 6 dial attempts after forgetting, got %d", attempts)
+	}
+}
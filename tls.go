@@ -0,0 +1,240 @@
+package ara
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// DialTLSContext connects to the address on the named network like
+// DialContext and then initiates a TLS handshake, returning the
+// resulting TLS connection.
+//
+// Although the connection is made to the address chosen through the
+// Resolver, the original host name is used for SNI and to verify the
+// server's certificate, unless ServerNames or config says otherwise.
+// The settings in HostTLS for the host are applied on top of config.
+//
+// A nil config is equivalent to the zero configuration. The provided
+// Context must be non-nil and also bounds the handshake.
+func (d *Dialer) DialTLSContext(ctx context.Context, network, address string, config *tls.Config) (net.Conn, error) {
+	return d.dialTLS(ctx, d.DialContext, network, address, config, 0)
+}
+
+// tlsHandshakeTimeoutError is returned when a TLS handshake takes
+// longer than the TLSHandshakeTimeout of a transport.
+type tlsHandshakeTimeoutError struct{}
+
+func (tlsHandshakeTimeoutError) Error() string {
+	return "ara: TLS handshake timeout"
+}
+
+func (tlsHandshakeTimeoutError) Timeout() bool {
+	return true
+}
+
+func (tlsHandshakeTimeoutError) Temporary() bool {
+	return true
+}
+
+// dialTLS connects to the address with dial and then initiates a TLS
+// handshake like DialTLSContext. A positive handshakeTimeout limits
+// the duration of the handshake.
+func (d *Dialer) dialTLS(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), network, address string, config *tls.Config, handshakeTimeout time.Duration) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.HostTLS) > 0 || len(d.ServerNames) > 0 {
+		// Do not let a name that the settings cannot match reach the
+		// server without them.
+		if _, err := normalizeHost(host); err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Addr: simpleAddr{addr: address, network: network}, Err: invalidHostError(host, err)}
+		}
+	}
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	handshakeCtx := ctx
+	if handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		handshakeCtx, cancel = context.WithTimeout(ctx, handshakeTimeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, d.tlsConfig(host, config))
+	err = handshake(handshakeCtx, conn, tlsConn.Handshake)
+	if err != nil {
+		_ = conn.Close()
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			err = tlsHandshakeTimeoutError{}
+		}
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// tlsConfig returns a copy of config set up for the given host.
+func (d *Dialer) tlsConfig(host string, config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if serverName, ok := d.serverName(host); ok {
+		config.ServerName = serverName
+	} else if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if c := d.hostTLSConfig(host); c != nil {
+		c.apply(config)
+	}
+	return config
+}
+
+// HostTLSConfig holds the TLS settings that apply to a group of hosts
+// on top of the configuration given to DialTLSContext.
+type HostTLSConfig struct {
+	// RootCAs, if not nil, replaces the set of root certificate
+	// authorities used to verify the server's certificate.
+	RootCAs *x509.CertPool
+
+	// Certificates, if not empty, replaces the certificates that
+	// are presented to the server for mutual TLS.
+	Certificates []tls.Certificate
+
+	// Pins optionally lists the base64 encoded SHA-256 hashes of the
+	// DER encoded SubjectPublicKeyInfo of trusted certificates, like
+	// the pin-sha256 values of HTTP Public Key Pinning. If not empty,
+	// at least one certificate in the server's chain must match one
+	// of the pins.
+	Pins []string
+
+	// MinVersion, if not zero, replaces the minimum TLS version.
+	MinVersion uint16
+
+	// InsecureSkipVerify, if true, disables the verification of the
+	// server's certificate chain and host name for these hosts only.
+	// Pins are still checked, against the leaf certificate the server
+	// presents only, as it is the only one whose key the server proves
+	// to hold.
+	InsecureSkipVerify bool
+}
+
+// apply overrides the settings of config with the ones of c.
+func (c *HostTLSConfig) apply(config *tls.Config) {
+	if c.RootCAs != nil {
+		config.RootCAs = c.RootCAs
+	}
+	if len(c.Certificates) > 0 {
+		config.Certificates = c.Certificates
+	}
+	if c.MinVersion != 0 {
+		config.MinVersion = c.MinVersion
+	}
+	if c.InsecureSkipVerify {
+		config.InsecureSkipVerify = true
+	}
+	if len(c.Pins) > 0 {
+		pins := c.Pins
+		verify := config.VerifyPeerCertificate
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if verify != nil {
+				err := verify(rawCerts, verifiedChains)
+				if err != nil {
+					return err
+				}
+			}
+			return checkPins(pins, rawCerts, verifiedChains)
+		}
+	}
+}
+
+var errPinMismatch = errors.New("ara: no certificate matches the pinned public keys")
+
+var errHostTLSTransportProxy = errors.New("ara: HostTLS cannot be applied through the proxy of a transport, set the Proxy of the Dialer instead")
+
+// checkPins verifies that a certificate of the verified chains, or the
+// presented leaf certificate if there are none, matches one of the
+// pins. The other presented certificates are not checked without a
+// verified chain, as anyone can send a copy of a pinned certificate
+// after their own.
+func checkPins(pins []string, rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	var certs []*x509.Certificate
+	for _, chain := range verifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(verifiedChains) == 0 && len(rawCerts) > 0 {
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		pin := base64.StdEncoding.EncodeToString(sum[:])
+		for _, p := range pins {
+			if p == pin {
+				return nil
+			}
+		}
+	}
+	return errPinMismatch
+}
+
+// serverName returns the entry of the ServerNames of the Dialer for
+// host, comparing the normalized host names.
+func (d *Dialer) serverName(host string) (string, bool) {
+	if len(d.ServerNames) == 0 {
+		return "", false
+	}
+	if serverName, ok := d.ServerNames[host]; ok {
+		return serverName, true
+	}
+	name := normalizeHostLoosely(host)
+	for h, serverName := range d.ServerNames {
+		if normalizeHostLoosely(h) == name {
+			return serverName, true
+		}
+	}
+	return "", false
+}
+
+// hostTLSConfig returns the HostTLSConfig of the Dialer that matches
+// host, comparing the normalized host names. Exact matches win over
+// wildcards, and more specific wildcards win over less specific ones.
+// The host names that cannot be normalized match nothing.
+func (d *Dialer) hostTLSConfig(host string) *HostTLSConfig {
+	if len(d.HostTLS) == 0 {
+		return nil
+	}
+	name, err := normalizeHost(host)
+	if err != nil {
+		return nil
+	}
+	var match *HostTLSConfig
+	matchLen := -1
+	for pattern, c := range d.HostTLS {
+		pattern = normalizePattern(pattern)
+		switch {
+		case pattern == name:
+			return c
+		case pattern == "*":
+			if matchLen < 0 {
+				match, matchLen = c, 0
+			}
+		case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(name, pattern[1:]):
+			if len(pattern) > matchLen {
+				match, matchLen = c, len(pattern)
+			}
+		}
+	}
+	return match
+}
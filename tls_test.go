@@ -0,0 +1,235 @@
+package ara_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cevatbarisyilmaz/ara"
+)
+
+func TestDialTLSContext(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.ServerName))
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	config := &tls.Config{RootCAs: roots}
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{
+			"example.com": {"127.0.0.1"},
+			"other.test":  {"127.0.0.1"},
+		}),
+	}
+	conn, err := dialer.DialTLSContext(context.Background(), "tcp", "example.com:"+port, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.(*tls.Conn).ConnectionState().ServerName != "example.com" {
+		t.Error("wrong server name")
+	}
+	_ = conn.Close()
+	_, err = dialer.DialTLSContext(context.Background(), "tcp", "other.test:"+port, config)
+	if err == nil {
+		t.Fatal("certificate of another host is accepted")
+	}
+	dialer.ServerNames = map[string]string{"other.test": "example.com"}
+	conn, err = dialer.DialTLSContext(context.Background(), "tcp", "other.test:"+port, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	transport := ara.NewTransport(ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}))
+	transport.TLSClientConfig = config
+	client := http.Client{Transport: transport}
+	response, err := client.Get("https://example.com:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if string(body) != "example.com" {
+		t.Errorf("wrong server name %q", body)
+	}
+
+	// TLS connections are dialed with the DialContext of the
+	// transport, even when it is replaced.
+	transport = ara.NewTransport(ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}))
+	transport.TLSClientConfig = config
+	var dials int
+	dialContext := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		return dialContext(ctx, network, addr)
+	}
+	client = http.Client{Transport: transport}
+	response, err = client.Get("https://example.com:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if dials != 1 {
+		t.Errorf("replaced DialContext is called %d times", dials)
+	}
+}
+
+func TestHostTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	sum := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{
+			"api.example.com": {"127.0.0.1"},
+			"bad.example.com": {"127.0.0.1"},
+			"staging.test":    {"127.0.0.1"},
+		}),
+		HostTLS: map[string]*ara.HostTLSConfig{
+			"*.example.com":   {RootCAs: roots, Pins: []string{pin}},
+			"bad.example.com": {RootCAs: roots, Pins: []string{base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}},
+			"staging.test":    {InsecureSkipVerify: true},
+		},
+	}
+	for _, test := range []struct {
+		host string
+		ok   bool
+	}{
+		{"api.example.com", true},
+		{"bad.example.com", false},
+		{"staging.test", true},
+		{"ＳＴＡＧＩＮＧ.test", true},
+	} {
+		conn, err := dialer.DialTLSContext(context.Background(), "tcp", test.host+":"+port, nil)
+		if test.ok && err != nil {
+			t.Errorf("dial to %s failed: %v", test.host, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("dial to %s succeeded", test.host)
+		}
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+	_, err = (&ara.Dialer{Resolver: dialer.Resolver}).DialTLSContext(context.Background(), "tcp", "staging.test:"+port, nil)
+	if err == nil {
+		t.Error("verification is skipped without HostTLS")
+	}
+}
+
+func TestHostTLSTransportProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := ara.NewClient(ara.NewCustomResolver(nil), ara.WithTransportOptions(
+		ara.WithHostTLS(map[string]*ara.HostTLSConfig{
+			"example.com": {Pins: []string{base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}},
+		}),
+		ara.WithProxy(http.ProxyURL(proxyURL)),
+	))
+	_, err = client.Get("https://example.com/")
+	if err == nil {
+		t.Error("request through the proxy of the transport succeeded")
+	}
+	if atomic.LoadInt32(&proxied) != 0 {
+		t.Error("request reached the proxy")
+	}
+	// The settings do not matter without TLS.
+	response, err := client.Get("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Error("plain request did not reach the proxy")
+	}
+}
+
+func TestHostTLSPinsWithoutVerification(t *testing.T) {
+	pinned := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer pinned.Close()
+	sum := sha256.Sum256(pinned.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	// An attacker presents their own certificate, followed by a copy of
+	// the pinned one.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"staging.test"},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacker := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	attacker.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf, pinned.Certificate().Raw},
+		PrivateKey:  key,
+	}}}
+	attacker.StartTLS()
+	defer attacker.Close()
+
+	dialer := ara.Dialer{
+		Resolver: ara.NewCustomResolver(map[string][]string{"staging.test": {"127.0.0.1"}}),
+		HostTLS: map[string]*ara.HostTLSConfig{
+			"staging.test": {InsecureSkipVerify: true, Pins: []string{pin}},
+		},
+	}
+	for _, server := range []*httptest.Server{pinned, attacker} {
+		_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := dialer.DialTLSContext(context.Background(), "tcp", "staging.test:"+port, nil)
+		if server == pinned && err != nil {
+			t.Errorf("dial to the pinned server failed: %v", err)
+		}
+		if server == attacker && (err == nil || !strings.Contains(err.Error(), "pinned public keys")) {
+			t.Errorf("expected a pin mismatch, got %v", err)
+		}
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+}
@@ -1,23 +1,237 @@
 package ara
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 )
 
+// A TransportOption configures the transport returned by NewTransport
+// and the Dialer behind it.
+type TransportOption func(d *Dialer, t *http.Transport)
+
+// WithDialTimeout sets the Timeout of the Dialer.
+// The default is 30 seconds.
+func WithDialTimeout(timeout time.Duration) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		d.Timeout = timeout
+	}
+}
+
+// WithKeepAlive sets the KeepAlive of the Dialer.
+// The default is 30 seconds.
+func WithKeepAlive(keepAlive time.Duration) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		d.KeepAlive = keepAlive
+	}
+}
+
+// WithDialer calls configure with the Dialer, to set any of its fields
+// that do not have an option of their own.
+func WithDialer(configure func(d *Dialer)) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		configure(d)
+	}
+}
+
+// WithProxy sets the Proxy of the transport. A nil proxy disables
+// proxies. The default is http.ProxyFromEnvironment.
+//
+// The Dialer only sees the address of the proxy server when the
+// transport sends a request through a proxy, which resolves the target
+// host itself, and the transport makes the TLS handshakes of such
+// requests itself. So these requests fail if the Resolver of the Dialer
+// or the context of the request overrides the host, as described in
+// PoolTransport, if the Dialer has a HostPolicy or an IPPolicy, or if
+// it has HostTLS settings for the host of an HTTPS request. Set the
+// Proxy of the Dialer instead to have them applied to the targets.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.Proxy = checkedProxy(d, proxy)
+	}
+}
+
+var errResolverTransportProxy = errors.New("ara: the resolution of the host cannot be overridden through the proxy of a transport, set the Proxy of the Dialer instead")
+
+// checkedProxy returns proxy wrapped so that the requests it sends
+// through a proxy fail when d has settings that the proxy would
+// bypass. It returns nil if proxy is nil.
+func checkedProxy(d *Dialer, proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	if proxy == nil {
+		return nil
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := proxy(req)
+		if err != nil || u == nil {
+			return u, err
+		}
+		if d.HostPolicy != nil || d.IPPolicy != nil {
+			return nil, errPolicyTransportProxy
+		}
+		if overridden(req.Context(), d.Resolver, req.URL.Hostname()) {
+			return nil, errResolverTransportProxy
+		}
+		if req.URL.Scheme == "https" && d.hostTLSConfig(req.URL.Hostname()) != nil {
+			return nil, errHostTLSTransportProxy
+		}
+		return u, nil
+	}
+}
+
+// WithHTTP2 sets whether the transport attempts HTTP/2.
+// The default is true.
+func WithHTTP2(enabled bool) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.ForceAttemptHTTP2 = enabled
+		if enabled {
+			t.TLSNextProto = nil
+		} else {
+			t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+	}
+}
+
+// WithTLSConfig sets the TLSClientConfig of the transport.
+func WithTLSConfig(config *tls.Config) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.TLSClientConfig = config
+	}
+}
+
+// WithHostTLS sets the HostTLS of the Dialer.
+func WithHostTLS(hosts map[string]*HostTLSConfig) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		d.HostTLS = hosts
+	}
+}
+
+// WithNetworkConditions sets the Conditions of the Dialer.
+func WithNetworkConditions(conditions *NetworkConditions) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		d.Conditions = conditions
+	}
+}
+
+// WithTLSHandshakeTimeout sets the TLSHandshakeTimeout of the transport,
+// which also bounds the TLS handshakes made by the Dialer.
+// The default is 10 seconds.
+func WithTLSHandshakeTimeout(timeout time.Duration) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.TLSHandshakeTimeout = timeout
+	}
+}
+
+// WithMaxIdleConns sets the MaxIdleConns of the transport.
+// The default is 100.
+func WithMaxIdleConns(n int) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.MaxIdleConns = n
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the MaxIdleConnsPerHost of the transport.
+func WithMaxIdleConnsPerHost(n int) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.MaxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost sets the MaxConnsPerHost of the transport.
+func WithMaxConnsPerHost(n int) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.MaxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets the IdleConnTimeout of the transport.
+// The default is 90 seconds.
+func WithIdleConnTimeout(timeout time.Duration) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.IdleConnTimeout = timeout
+	}
+}
+
+// WithExpectContinueTimeout sets the ExpectContinueTimeout of the transport.
+// The default is 1 second.
+func WithExpectContinueTimeout(timeout time.Duration) TransportOption {
+	return func(d *Dialer, t *http.Transport) {
+		t.ExpectContinueTimeout = timeout
+	}
+}
+
 // NewTransport returns a *http.Transport that uses the given resolver while dialing.
-func NewTransport(r Resolver) *http.Transport {
-	return &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			Resolver:  r,
-		}).DialContext,
+//
+// Its settings can be changed with options, like
+//
+//	NewTransport(r, WithDialTimeout(5*time.Second), WithHTTP2(false))
+//
+// The transport uses the proxy of the environment, as described in
+// NewDialerTransport. The requests it would send through that proxy
+// fail for the hosts that r overrides, as the proxy would resolve them
+// itself, and the requests to the other hosts are resolved by the
+// proxy. To reach a proxy without these limits, use WithProxy(nil) and
+// set the Proxy of the Dialer with WithDialer.
+func NewTransport(r Resolver, opts ...TransportOption) *http.Transport {
+	_, t := newTransport(r, opts)
+	return t
+}
+
+func newTransport(r Resolver, opts []TransportOption) (*Dialer, *http.Transport) {
+	d := &Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Resolver:  r,
+	}
+	t := NewDialerTransport(d)
+	for _, opt := range opts {
+		opt(d, t)
+	}
+	return d, t
+}
+
+// NewDialerTransport returns a *http.Transport that uses the given dialer.
+//
+// The transport uses the proxy of the environment, like
+// http.DefaultTransport, but fails the requests it would send through
+// a proxy if the resolver of the dialer or the context of the request
+// overrides the host, which the proxy would resolve itself, if the
+// dialer has a HostPolicy or an IPPolicy, which would only be checked
+// against the address of the proxy server, or if it has HostTLS
+// settings for the host of an HTTPS request, which would be skipped.
+//
+// The returned transport sets DialTLSContext, so that settings of the
+// dialer like HostTLS and ServerNames apply to TLS connections. These
+// connections are dialed with the DialContext of the transport, even
+// if it is replaced later on, as to wrap it, and are then set up like
+// Dialer.DialTLSContext does, using the TLSClientConfig and the
+// TLSHandshakeTimeout of the transport. Setting DialTLSContext to nil
+// leaves TLS to the transport, without these settings.
+func NewDialerTransport(d *Dialer) *http.Transport {
+	transport := &http.Transport{
+		Proxy:                 checkedProxy(d, http.ProxyFromEnvironment),
+		DialContext:           d.DialContext,
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
+	transport.DialTLSContext = dialTLSFunc(d, transport)
+	return transport
+}
+
+// dialTLSFunc returns the DialTLSContext of transport, which dials with
+// its current DialContext and sets TLS up with d.
+func dialTLSFunc(d *Dialer, transport *http.Transport) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = d.DialContext
+		}
+		return d.dialTLS(ctx, dial, network, addr, transport.TLSClientConfig, transport.TLSHandshakeTimeout)
+	}
 }
@@ -3,11 +3,17 @@ package ara_test
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"github.com/cevatbarisyilmaz/ara"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNewTransport(t *testing.T) {
@@ -45,3 +51,126 @@ func TestNewTransport(t *testing.T) {
 		t.Fatal("failed")
 	}
 }
+
+func TestTransportOptions(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	resolver := ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}})
+	for _, http2 := range []bool{true, false} {
+		client := http.Client{Transport: ara.NewTransport(resolver,
+			ara.WithProxy(nil),
+			ara.WithDialTimeout(time.Second),
+			ara.WithTLSConfig(&tls.Config{RootCAs: roots}),
+			ara.WithHTTP2(http2),
+		)}
+		response, err := client.Get("https://example.com:" + port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		if http2 && response.ProtoMajor != 2 {
+			t.Error("HTTP/2 is not used")
+		} else if !http2 && response.ProtoMajor != 1 {
+			t.Error("HTTP/2 is not disabled")
+		}
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// The server accepts the connections but never answers the
+	// handshakes.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := http.Client{Transport: ara.NewTransport(
+		ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}),
+		ara.WithProxy(nil),
+		ara.WithTLSHandshakeTimeout(100*time.Millisecond),
+	)}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	request, err := http.NewRequest(http.MethodGet, "https://example.com:"+port, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = client.Do(request.WithContext(ctx))
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the handshake timed out after %s", elapsed)
+	}
+}
+
+func TestResolverTransportProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := ara.NewTransport(
+		ara.NewCustomResolver(map[string][]string{"example.com": {"127.0.0.1"}}),
+		ara.WithProxy(http.ProxyURL(proxyURL)),
+	)
+	client := http.Client{Transport: transport}
+	_, err = client.Get("http://example.com/")
+	if err == nil {
+		t.Error("request to a mapped host through the proxy of the transport succeeded")
+	}
+	request, err := http.NewRequest(http.MethodGet, "http://other.test/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ara.WithHosts(context.Background(), map[string][]string{"other.test": {"127.0.0.1"}})
+	_, err = client.Do(request.WithContext(ctx))
+	if err == nil {
+		t.Error("request to an overridden host through the proxy of the transport succeeded")
+	}
+	if atomic.LoadInt32(&proxied) != 0 {
+		t.Error("request to an overridden host reached the proxy")
+	}
+
+	// The proxy resolves the other hosts.
+	response, err := client.Get("http://other.test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Error("request did not reach the proxy")
+	}
+}